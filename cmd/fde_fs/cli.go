@@ -0,0 +1,475 @@
+package main
+
+import (
+	"errors"
+	"fde_fs/cmd/fde_fs/personal_fusing"
+	"fde_fs/config"
+	"fde_fs/logger"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Exit codes of fde_fs, fde_ctrl relies on them.
+const (
+	exitOK = 0
+	//the command ran and failed, see the log
+	exitFailure = 1
+	//unknown command, bad flag or argument
+	exitUsage = 2
+	//could not switch to root, fde_fs is not installed setuid
+	exitPermission = 3
+	//the android version could not be read, android is not installed
+	exitNoAndroid = 4
+)
+
+const exitCodesHelp = `Exit codes:
+  0  success
+  1  the command failed, see the log
+  2  usage error: unknown command, bad flag or argument
+  3  permission denied: fde_fs is not setuid root
+  4  android is not installed: its version could not be read
+`
+
+// command is a subcommand of fde_fs, such as "ptfs mount".
+type command struct {
+	name    string
+	args    string
+	summary string
+	//root runs the command with the real uid switched to root
+	root bool
+	//aosp reads the android version first, see readAospVersion
+	aosp bool
+	//flags declares the flags of the command, may be nil
+	flags func(fs *flag.FlagSet)
+	//nargs is the number of arguments, -1 for any
+	nargs int
+	run   func(args []string) int
+}
+
+var mountDebug bool
+
+var commands = []*command{
+	{
+		name:    "mount",
+		summary: "mount the volumes and the user data, and stay in the foreground",
+		root:    true,
+		aosp:    true,
+		flags: func(fs *flag.FlagSet) {
+			fs.BoolVar(&mountDebug, "d", false, "fuse debug output, and no redaction of the log")
+		},
+		run: func([]string) int { return mountVolumes(mountDebug) },
+	},
+	{
+		name:    "umount",
+		summary: "unmount all the volumes",
+		run: func([]string) int {
+			volumesLog.Info("umount_all_volumes")
+			logger.Sync()
+			if err := UmountAllVolumes(); err != nil {
+				volumesLog.WithError(err).Error("umount_failed")
+				return exitFailure
+			}
+			return exitOK
+		},
+	},
+	{
+		name:    "ptfs mount",
+		summary: "mount the personal folders into android, and stay in the foreground",
+		root:    true,
+		aosp:    true,
+		run: func([]string) int {
+			logger.WatchLevelSignals()
+			if err := personal_fusing.MountPtfs(aospVersion); err != nil {
+				return exitFailure
+			}
+			return exitOK
+		},
+	},
+	{
+		name:    "ptfs umount",
+		summary: "unmount the personal folders",
+		root:    true,
+		aosp:    true,
+		run: func([]string) int {
+			logger.Sync()
+			if err := personal_fusing.UmountPtfs(aospVersion); err != nil {
+				return exitFailure
+			}
+			return exitOK
+		},
+	},
+	{
+		name:    "ptfs status",
+		summary: "print true if the personal folders are mounted, false otherwise",
+		root:    true,
+		aosp:    true,
+		run: func([]string) int {
+			mounted, err := personal_fusing.GetPtfs(aospVersion)
+			if err != nil {
+				return exitFailure
+			}
+			fmt.Println(mounted)
+			return exitOK
+		},
+	},
+	{
+		name:    "android density",
+		args:    "DPI",
+		summary: "set the screen density of android",
+		root:    true,
+		nargs:   1,
+		run: func(args []string) int {
+			display := config.Get().Display
+			density, err := strconv.Atoi(args[0])
+			if err != nil || density < display.DensityMin || density > display.DensityMax {
+				fmt.Fprintf(os.Stderr, "error: a reasonable density value is typically between %d and %d.\n", display.DensityMin, display.DensityMax)
+				logger.Warn("set_density_out_of_range", args[0])
+				return exitUsage
+			}
+			if err := setDensity(density); err != nil {
+				return exitFailure
+			}
+			return exitOK
+		},
+	},
+	{
+		name:    "android navmode",
+		args:    "gesture|3btn",
+		summary: "set the navigation mode of android",
+		root:    true,
+		nargs:   1,
+		run: func(args []string) int {
+			var mode NavigateionMode
+			switch args[0] {
+			case "gesture", string(NavigationGesture):
+				mode = NavigationGesture
+			case "3btn", string(Navigation3Btn):
+				mode = Navigation3Btn
+			default:
+				fmt.Fprintf(os.Stderr, "unknown navigation mode %q, expected gesture or 3btn\n", args[0])
+				return exitUsage
+			}
+			if err := setMode(mode); err != nil {
+				return exitFailure
+			}
+			return exitOK
+		},
+	},
+	{
+		name:    "install",
+		args:    "DEB",
+		summary: "install an openfde deb and restart openfde",
+		root:    true,
+		nargs:   1,
+		run: func(args []string) int {
+			if info, err := os.Stat(args[0]); err != nil || !info.Mode().IsRegular() {
+				fmt.Fprintf(os.Stderr, "%s is not a deb file\n", args[0])
+				return exitUsage
+			}
+			return installOpenfde(args[0])
+		},
+	},
+	{
+		name:    "log rotate",
+		summary: "rotate the log file",
+		run: func([]string) int {
+			logger.Rotate()
+			return exitOK
+		},
+	},
+	{
+		name:    "log level",
+		args:    "LEVEL",
+		summary: "set the log level of the running daemons (error, warn, info, debug, trace), SIGUSR1/SIGUSR2 step it up/down",
+		root:    true,
+		nargs:   1,
+		run: func(args []string) int {
+			if _, err := logger.ParseLevel(args[0]); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return exitUsage
+			}
+			if err := setLogLevel(args[0]); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return exitFailure
+			}
+			return exitOK
+		},
+	},
+	{
+		name:    "status",
+		summary: "print the state of the volumes, the personal folders and the log",
+		run:     printStatus,
+	},
+	{
+		name:    "config",
+		summary: "print the effective configuration of " + config.SystemFile + " and the user file",
+		run: func([]string) int {
+			for _, err := range config.Errors() {
+				fmt.Fprintln(os.Stderr, "ignored", err)
+			}
+			if err := config.Get().Print(os.Stdout); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return exitFailure
+			}
+			return exitOK
+		},
+	},
+	{
+		name:    "suspend",
+		summary: "flush the log and suspend the system",
+		root:    true,
+		run: func([]string) int {
+			//the log may not survive a failed resume
+			logger.Sync()
+			if err := exec.Command("systemctl", "suspend").Run(); err != nil {
+				logger.Error("system_sleep_failed", nil, err)
+				return exitFailure
+			}
+			return exitOK
+		},
+	},
+	{
+		name:    "sysctl",
+		summary: "reload the kernel parameters, sysctl -p",
+		run: func([]string) int {
+			if err := exec.Command("sysctl", "-p").Run(); err != nil {
+				logger.Error("sysctl_p_failed", nil, err)
+				return exitFailure
+			}
+			logger.Info("sysctl_p_executed", "sysctl -p command executed successfully")
+			return exitOK
+		},
+	},
+	{
+		name:    "softmode",
+		summary: "turn off the execution control of kylinos",
+		run: func([]string) int {
+			status, err := getStatus()
+			if err != nil {
+				logger.Error("exectl_off_set", nil, err)
+				return exitFailure
+			}
+			if err := setExeCtlOff(status); err != nil {
+				return exitFailure
+			}
+			return exitOK
+		},
+	},
+	{
+		name:    "version",
+		summary: "print the version",
+		run: func([]string) int {
+			fmt.Printf("Version: %s, tag: %s , date: %s \n", _version_, _tag_, _date_)
+			return exitOK
+		},
+	},
+}
+
+// findCommand returns the command named by the first words of args and the
+// remaining arguments.
+func findCommand(args []string) (*command, []string) {
+	var found *command
+	var rest []string
+	for _, cmd := range commands {
+		words := strings.Fields(cmd.name)
+		if len(args) < len(words) || strings.Join(args[:len(words)], " ") != cmd.name {
+			continue
+		}
+		if found == nil || len(words) > len(strings.Fields(found.name)) {
+			found, rest = cmd, args[len(words):]
+		}
+	}
+	return found, rest
+}
+
+// run executes the command line args, without the program name, and returns
+// the exit code.
+func run(args []string) int {
+	if len(args) > 0 && strings.HasPrefix(args[0], "-") && args[0] != "-h" && args[0] != "--help" {
+		legacy, err := legacyArgs(args)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			usage(os.Stderr)
+			return exitUsage
+		}
+		args = legacy
+	}
+	if len(args) == 0 {
+		usage(os.Stderr)
+		return exitUsage
+	}
+	if args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		if len(args) > 1 {
+			if cmd, rest := findCommand(args[1:]); cmd != nil && len(rest) == 0 {
+				cmd.usage(os.Stdout)
+				return exitOK
+			}
+			fmt.Fprintf(os.Stderr, "unknown command %q\n", strings.Join(args[1:], " "))
+			return exitUsage
+		}
+		usage(os.Stdout)
+		return exitOK
+	}
+	cmd, rest := findCommand(args)
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", strings.Join(args, " "))
+		usage(os.Stderr)
+		return exitUsage
+	}
+	return cmd.execute(rest)
+}
+
+// execute parses the flags and arguments of the command, switches to root
+// and reads the android version when the command needs it, then runs it.
+func (cmd *command) execute(args []string) int {
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	if cmd.flags != nil {
+		cmd.flags(fs)
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			cmd.usage(os.Stdout)
+			return exitOK
+		}
+		fmt.Fprintln(os.Stderr, err)
+		cmd.usage(os.Stderr)
+		return exitUsage
+	}
+	if cmd.nargs >= 0 && fs.NArg() != cmd.nargs {
+		fmt.Fprintf(os.Stderr, "%s takes %d argument(s), got %d\n", cmd.name, cmd.nargs, fs.NArg())
+		cmd.usage(os.Stderr)
+		return exitUsage
+	}
+
+	if cmd.root {
+		if err := syscall.Setreuid(0, 0); err != nil {
+			logger.Error("setreuid_error", cmd.name, err)
+			fmt.Fprintln(os.Stderr, "fde_fs must be installed setuid root:", err)
+			return exitPermission
+		}
+	}
+	if cmd.aosp {
+		readAospVersion()
+		if len(aospVersion) == 0 {
+			logger.Error("read_aosp_version", nil, errors.New("aosp ver empty"))
+			if cmd.name == "ptfs umount" {
+				logger.Warn("read_aosp_version_failed", "aosp version is empty, but continue to umount ptfs")
+				personal_fusing.UmountPtfs("")
+			}
+			return exitNoAndroid
+		}
+		if aospVersion == "11" {
+			aospVersion = ""
+		}
+		LocalOpenfde = personal_fusing.LocalShareOpenfde + aospVersion
+		_ = syscall.Setreuid(LinuxUID, 0)
+	}
+	return cmd.run(fs.Args())
+}
+
+func (cmd *command) usage(w io.Writer) {
+	fmt.Fprintf(w, "usage: fde_fs %s", cmd.name)
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	if cmd.flags != nil {
+		cmd.flags(fs)
+		fmt.Fprint(w, " [flags]")
+	}
+	if cmd.args != "" {
+		fmt.Fprint(w, " ", cmd.args)
+	}
+	fmt.Fprintf(w, "\n\n%s\n", cmd.summary)
+	if cmd.flags != nil {
+		fmt.Fprintln(w, "\nFlags:")
+		fs.SetOutput(w)
+		fs.PrintDefaults()
+	}
+	fmt.Fprint(w, "\n", exitCodesHelp)
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: fde_fs COMMAND [ARGS]")
+	fmt.Fprintln(w, "\nCommands:")
+	for _, cmd := range commands {
+		name := cmd.name
+		if cmd.args != "" {
+			name += " " + cmd.args
+		}
+		fmt.Fprintf(w, "  %-28s %s\n", name, cmd.summary)
+	}
+	fmt.Fprintln(w, "\nRun fde_fs help COMMAND for the flags of a command.")
+	fmt.Fprint(w, "\n", exitCodesHelp)
+}
+
+// legacyFlags maps the flags of the former command line to the commands
+// replacing them, in the order they took precedence.
+var legacyFlags = []struct {
+	flag string
+	args func(values map[string]string) []string
+}{
+	{"print-config", func(map[string]string) []string { return []string{"config"} }},
+	{"install", func(v map[string]string) []string { return []string{"install", v["path"]} }},
+	{"loglevel", func(v map[string]string) []string { return []string{"log", "level", v["loglevel"]} }},
+	{"sleep", func(map[string]string) []string { return []string{"suspend"} }},
+	{"setnav", func(v map[string]string) []string { return []string{"android", "navmode", v["navmode"]} }},
+	{"density", func(v map[string]string) []string { return []string{"android", "density", v["density"]} }},
+	{"logrotate", func(map[string]string) []string { return []string{"log", "rotate"} }},
+	{"pwrite", func(map[string]string) []string { return []string{"sysctl"} }},
+	{"s", func(map[string]string) []string { return []string{"softmode"} }},
+	{"pq", func(map[string]string) []string { return []string{"ptfs", "status"} }},
+	{"pm", func(map[string]string) []string { return []string{"ptfs", "mount"} }},
+	{"pu", func(map[string]string) []string { return []string{"ptfs", "umount"} }},
+	{"h", func(map[string]string) []string { return []string{"help"} }},
+	{"v", func(map[string]string) []string { return []string{"version"} }},
+	{"u", func(map[string]string) []string { return []string{"umount"} }},
+	{"m", func(v map[string]string) []string {
+		if v["d"] == "true" {
+			return []string{"mount", "-d"}
+		}
+		return []string{"mount"}
+	}},
+}
+
+// legacyArgs translates the former flags, e.g. -pm or -density 160, into the
+// command replacing them, so existing callers keep working.
+func legacyArgs(args []string) ([]string, error) {
+	fs := flag.NewFlagSet("fde_fs", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	for _, name := range []string{"m", "v", "u", "h", "d", "sleep", "pm", "pu", "pq", "s", "pwrite",
+		"logrotate", "setnav", "install", "print-config"} {
+		fs.Bool(name, false, "")
+	}
+	fs.String("navmode", "0", "")
+	fs.String("path", "", "")
+	fs.String("loglevel", "", "")
+	fs.Int("density", 0, "")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	values := make(map[string]string)
+	fs.VisitAll(func(f *flag.Flag) {
+		values[f.Name] = f.Value.String()
+	})
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = values[f.Name] != "" && values[f.Name] != "false" && values[f.Name] != "0"
+	})
+	for _, legacy := range legacyFlags {
+		if set[legacy.flag] {
+			return legacy.args(values), nil
+		}
+	}
+	var names []string
+	for name := range set {
+		names = append(names, "-"+name)
+	}
+	sort.Strings(names)
+	return nil, fmt.Errorf("nothing to do with %s", strings.Join(names, " "))
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_legacyArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    []string
+		wantErr bool
+	}{
+		{name: "mount", args: []string{"-m"}, want: []string{"mount"}},
+		{name: "mount debug", args: []string{"-m", "-d"}, want: []string{"mount", "-d"}},
+		{name: "ptfs mount", args: []string{"-pm"}, want: []string{"ptfs", "mount"}},
+		{name: "density", args: []string{"-density", "160"}, want: []string{"android", "density", "160"}},
+		{name: "navmode", args: []string{"-setnav", "-navmode", "1"}, want: []string{"android", "navmode", "1"}},
+		{name: "install", args: []string{"-install", "-path", "/tmp/a.deb"}, want: []string{"install", "/tmp/a.deb"}},
+		{name: "precedence", args: []string{"-u", "-sleep"}, want: []string{"suspend"}},
+		{name: "unknown flag", args: []string{"-x"}, wantErr: true},
+		{name: "nothing to do", args: []string{"-d"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := legacyArgs(tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("legacyArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("legacyArgs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_findCommand(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		wantName string
+		wantRest []string
+	}{
+		{name: "single word", args: []string{"mount", "-d"}, wantName: "mount", wantRest: []string{"-d"}},
+		{name: "longest match", args: []string{"ptfs", "mount"}, wantName: "ptfs mount", wantRest: []string{}},
+		{name: "argument", args: []string{"android", "density", "160"}, wantName: "android density", wantRest: []string{"160"}},
+		{name: "unknown", args: []string{"ptfs", "foo"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, rest := findCommand(tt.args)
+			if tt.wantName == "" {
+				if cmd != nil {
+					t.Errorf("findCommand() = %s, want none", cmd.name)
+				}
+				return
+			}
+			if cmd == nil || cmd.name != tt.wantName {
+				t.Fatalf("findCommand() = %v, want %s", cmd, tt.wantName)
+			}
+			if !reflect.DeepEqual(rest, tt.wantRest) {
+				t.Errorf("findCommand() rest = %v, want %v", rest, tt.wantRest)
+			}
+		})
+	}
+}
+
+func Test_isDaemonCmdline(t *testing.T) {
+	tests := []struct {
+		args []string
+		want bool
+	}{
+		{[]string{"fde_fs", "mount"}, true},
+		{[]string{"fde_fs", "ptfs", "mount"}, true},
+		{[]string{"fde_fs", "-m"}, true},
+		{[]string{"fde_fs", "-pm"}, true},
+		{[]string{"fde_fs", "ptfs", "umount"}, false},
+		{[]string{"fde_fs", "umount"}, false},
+		{[]string{"fde_fs"}, false},
+	}
+	for _, tt := range tests {
+		if got := isDaemonCmdline(tt.args); got != tt.want {
+			t.Errorf("isDaemonCmdline(%v) = %v, want %v", tt.args, got, tt.want)
+		}
+	}
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"fde_fs/logger"
 	"os"
 	"strconv"
 	"syscall"
@@ -9,8 +8,25 @@ import (
 	"github.com/winfsp/cgofuse/fuse"
 )
 
+// caller is the process an operation is served for, given by netFS which
+// serves it on another thread than the one of FUSE.
+type caller struct {
+	uid uint32
+	gid uint32
+	pid int
+}
+
+// getcontext returns the caller of the operation being served, see
+// fuse.Getcontext.
+func (self *Ptfs) getcontext() (uint32, uint32, int) {
+	if self.caller != nil {
+		return self.caller.uid, self.caller.gid, self.caller.pid
+	}
+	return fuse.Getcontext()
+}
+
 func (self *Ptfs) isHostNS() bool {
-	_, _, pid := fuse.Getcontext()
+	_, _, pid := self.getcontext()
 	ns, err := self.readNS(strconv.Itoa(pid))
 	if err != nil {
 		return false
@@ -25,7 +41,7 @@ func (self *Ptfs) readNS(pid string) (nsid uint64, err error) {
 	file := "/proc/" + pid + "/ns/pid"
 	fd, err := os.Open(file)
 	if err != nil {
-		logger.Error("read_name_space_fs", nil, err)
+		ptfsLog.WithError(err).Error("read_name_space_fs", "pid", pid)
 		return
 	}
 	defer fd.Close()
@@ -40,7 +56,7 @@ func (self *Ptfs) recordNameSpace() {
 	var err error
 	self.ns, err = self.readNS(strconv.Itoa(pid))
 	if err != nil {
-		logger.Error("record_ns", nil, err)
+		ptfsLog.WithError(err).Error("record_ns", "pid", pid)
 	}
 	return
 
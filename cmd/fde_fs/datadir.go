@@ -2,6 +2,7 @@ package main
 
 import (
 	"fde_fs/cmd/fde_fs/personal_fusing"
+	"fde_fs/config"
 	"fde_fs/logger"
 	"os"
 	"path/filepath"
@@ -9,7 +10,7 @@ import (
 	"syscall"
 )
 
-var media_rw = 1023 //the uid ,1023 is media_rw of android
+var media_rw = config.Get().Android.MediaRWUID //the uid ,1023 is media_rw of android
 
 func chownRecursive(startPath, lastPath string, uid, gid int) error {
 	dirList := strings.Split(lastPath, "/")
@@ -28,10 +29,10 @@ func chownRecursive(startPath, lastPath string, uid, gid int) error {
 
 func MKDataDir(aospVer string) (media0, homeOpenfde string, err error) {
 	localShareOpenfde := personal_fusing.LocalShareOpenfde + aospVer
-	logger.Info("print_local_openfde", personal_fusing.LocalShareOpenfde)
+	volumesLog.Info("print_local_openfde", "path", personal_fusing.LocalShareOpenfde)
 	home, err := os.UserHomeDir()
 	if err != nil {
-		logger.Error("mount_query_home_failed", os.Getuid(), err)
+		volumesLog.WithError(err).Error("mount_query_home_failed", "uid", os.Getuid())
 		return
 	}
 	//mkdir ~/.local/share/openfdexx/media/0
@@ -42,19 +43,19 @@ func MKDataDir(aospVer string) (media0, homeOpenfde string, err error) {
 		if os.IsNotExist(err) {
 			err = os.MkdirAll(media0, os.ModeDir+0751)
 			if err != nil {
-				logger.Error("mount_mkdir_for_user_datadir", media0, err)
+				volumesLog.WithError(err).Error("mount_mkdir_for_user_datadir", "path", media0)
 				return
 			}
 			uid := os.Getuid()
 			gid := os.Getgid()
 			err = chownRecursive(home, "/"+localShareOpenfde, uid, gid)
 			if err != nil {
-				logger.Error("fs_chown", "openfde", err)
+				volumesLog.WithError(err).Error("fs_chown", "path", origin)
 				return
 			}
 			chownRecursive(origin, "/media/0", media_rw, media_rw)
 			if err != nil {
-				logger.Error("fs_chown", "media_0", err)
+				volumesLog.WithError(err).Error("fs_chown", "path", media0)
 				return
 			}
 		}
@@ -67,12 +68,12 @@ func MKDataDir(aospVer string) (media0, homeOpenfde string, err error) {
 		if os.IsNotExist(err) {
 			err = os.Mkdir(iconsPath, os.ModeDir+0775)
 			if err != nil {
-				logger.Error("mkdir_icons", iconsPath, err)
+				volumesLog.WithError(err).Error("mkdir_icons", "path", iconsPath)
 				return
 			}
 			err = os.Chown(iconsPath, os.Getuid(), os.Getgid())
 			if err != nil {
-				logger.Error("chown_icons", iconsPath, err)
+				volumesLog.WithError(err).Error("chown_icons", "path", iconsPath)
 				return
 			}
 		}
@@ -84,7 +85,7 @@ func MKDataDir(aospVer string) (media0, homeOpenfde string, err error) {
 		if os.IsNotExist(err) {
 			err = os.MkdirAll(VolumesPathPrefix, os.ModeDir+0755)
 			if err != nil {
-				logger.Error("mount_mkdir_for_volumes", VolumesPathPrefix, err)
+				volumesLog.WithError(err).Error("mount_mkdir_for_volumes", "path", VolumesPathPrefix)
 				return
 			}
 		}
@@ -97,22 +98,31 @@ func MKDataDir(aospVer string) (media0, homeOpenfde string, err error) {
 		if os.IsNotExist(err) {
 			err = os.Mkdir(homeOpenfde, os.ModeDir+0751)
 			if err != nil {
-				logger.Error("mount_mkdir_for_user_datadir", homeOpenfde, err)
+				volumesLog.WithError(err).Error("mount_mkdir_for_user_datadir", "path", homeOpenfde)
 				return
 			}
 			err = os.Chown(homeOpenfde, os.Getuid(), os.Getgid())
 			if err != nil {
-				logger.Error("mount_mkdir_for_user_home_datadir", homeOpenfde, err)
+				volumesLog.WithError(err).Error("mount_mkdir_for_user_home_datadir", "path", homeOpenfde)
 				return
 			}
 		} else {
-			//if the dir is just not umounted ,then umount it
-			err = syscall.Unmount(homeOpenfde, 0)
+			//left mounted by a dead fde_fs, detach it
+			var stale bool
+			stale, err = detachStale(homeOpenfde)
 			if err != nil {
-				logger.Error("umount_volumes", homeOpenfde, err)
+				volumesLog.WithError(err).Error("umount_volumes", "path", homeOpenfde)
 				return
 			}
-
+			if stale {
+				volumesLog.Info("reconcile_detached_stale", "path", homeOpenfde)
+			} else {
+				err = logger.Wrap("unmount", homeOpenfde, syscall.Unmount(homeOpenfde, 0))
+				if err != nil {
+					volumesLog.WithError(err).Error("umount_volumes", "path", homeOpenfde)
+					return
+				}
+			}
 		}
 	}
 	return
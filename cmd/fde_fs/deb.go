@@ -7,6 +7,8 @@ import (
 	"os/exec"
 )
 
+var installLog = logger.Component("install")
+
 func installDEB(debPath string) error {
 	var cmd *exec.Cmd
 	mainCtx := context.Background()
@@ -20,24 +22,25 @@ func installDEB(debPath string) error {
 		return err
 	}
 
+	log := installLog.Op("dpkg_install").With("path", debPath)
 	if err := cmd.Start(); err != nil {
-		logger.Error("dpkg_install_start", nil, err)
+		log.WithError(err).Error("dpkg_install_start")
 		return err
 	}
 
 	scanner := bufio.NewScanner(output)
 	for scanner.Scan() {
 		line := scanner.Text()
-		logger.Error("install_deb_stdout", line, err)
+		log.Info("install_deb_stdout", "line", line)
 	}
 	scanner = bufio.NewScanner(outerr)
 	for scanner.Scan() {
 		line := scanner.Text()
-		logger.Error("install_deb_stderr", line, err)
+		log.Warn("install_deb_stderr", "line", line)
 	}
 
 	if err := cmd.Wait(); err != nil {
-		logger.Error("dpkg_install_wait", nil, err)
+		log.WithError(err).Error("dpkg_install_wait")
 		return err
 	}
 	return nil
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// The devices are identified by their major:minor, the third field of
+// mountinfo, which works the same for partitions, LVM, LUKS, md RAID and
+// NVMe, whatever the name they are mounted by.
+var (
+	diskByUUID  = "/dev/disk/by-uuid"
+	sysDevBlock = "/sys/dev/block"
+	sysFsBtrfs  = "/sys/fs/btrfs"
+)
+
+// devNum formats a device number as major:minor.
+func devNum(dev uint64) string {
+	return fmt.Sprintf("%d:%d", unix.Major(dev), unix.Minor(dev))
+}
+
+// isAnonymousDevNum tells whether num is not a block device, as btrfs and
+// the network file systems are mounted with.
+func isAnonymousDevNum(num string) bool {
+	return strings.HasPrefix(num, "0:")
+}
+
+// blockDevNum returns the major:minor of the block device at path.
+func blockDevNum(path string) (string, error) {
+	var st syscall.Stat_t
+	if err := syscall.Stat(path, &st); err != nil {
+		return "", err
+	}
+	if st.Mode&syscall.S_IFMT != syscall.S_IFBLK {
+		return "", syscall.ENOTBLK
+	}
+	return devNum(st.Rdev), nil
+}
+
+// blockDeviceName returns the /dev path the kernel names the device num by,
+// e.g. /dev/dm-0 or /dev/nvme0n1p2, or "" if it is not a block device.
+func blockDeviceName(num string) string {
+	f, err := os.Open(filepath.Join(sysDevBlock, num, "uevent"))
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if name, ok := strings.CutPrefix(scanner.Text(), "DEVNAME="); ok {
+			return "/dev/" + name
+		}
+	}
+	return ""
+}
+
+// btrfsMembers returns the major:minor of the devices of the btrfs file
+// system uuid, which may be mounted from any of them.
+func btrfsMembers(uuid string) []string {
+	files, _ := filepath.Glob(filepath.Join(sysFsBtrfs, uuid, "devices", "*", "dev"))
+	var members []string
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		if num := strings.TrimSpace(string(data)); num != "" {
+			members = append(members, num)
+		}
+	}
+	return members
+}
+
+// uuidDevNums returns the major:minor the volume uuid may be mounted with.
+func uuidDevNums(uuid string) ([]string, error) {
+	num, err := blockDevNum(filepath.Join(diskByUUID, uuid))
+	if err != nil {
+		return nil, err
+	}
+	return append([]string{num}, btrfsMembers(uuid)...), nil
+}
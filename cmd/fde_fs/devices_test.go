@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func writeSysFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_btrfsMembers(t *testing.T) {
+	defer func(dir string) { sysFsBtrfs = dir }(sysFsBtrfs)
+	sysFsBtrfs = t.TempDir()
+	uuid := "0b6a6c3e-1d3f-4a4e-9a53-7f1c2d3e4f50"
+	writeSysFile(t, filepath.Join(sysFsBtrfs, uuid, "devices", "sdb", "dev"), "8:16\n")
+	writeSysFile(t, filepath.Join(sysFsBtrfs, uuid, "devices", "sdc", "dev"), "8:32\n")
+
+	got := btrfsMembers(uuid)
+	sort.Strings(got)
+	if want := []string{"8:16", "8:32"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("btrfsMembers() = %v, want %v", got, want)
+	}
+	if got := btrfsMembers("not-btrfs"); len(got) != 0 {
+		t.Errorf("btrfsMembers() of another file system = %v", got)
+	}
+}
+
+func Test_blockDeviceName(t *testing.T) {
+	defer func(dir string) { sysDevBlock = dir }(sysDevBlock)
+	sysDevBlock = t.TempDir()
+	writeSysFile(t, filepath.Join(sysDevBlock, "259:2", "uevent"), "MAJOR=259\nMINOR=2\nDEVNAME=nvme0n1p2\nDEVTYPE=partition\n")
+
+	if got := blockDeviceName("259:2"); got != "/dev/nvme0n1p2" {
+		t.Errorf("blockDeviceName() = %q, want /dev/nvme0n1p2", got)
+	}
+	if got := blockDeviceName("0:27"); got != "" {
+		t.Errorf("blockDeviceName() of an anonymous device = %q", got)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fde_fs/config"
 	"fde_fs/logger"
 	"fmt"
 	"io/ioutil"
@@ -16,9 +17,9 @@ var LocalOpenfde string
 func readAospVersion() {
 	const codeKey = "ro.vendor.build.version.release_or_codename="
 	// Mount /usr/share/waydroid-extra/images/vendor.img to /tmp
-	vendorImgPath := "/usr/share/waydroid-extra/images/vendor.img"
+	vendorImgPath := config.Get().Android.VendorImage
 	tmpMountPoint := "/tmp/vendor_mount"
-	buildpropPath := "/var/lib/waydroid/rootfs/vendor/build.prop"
+	buildpropPath := config.Get().Android.BuildProp
 	var err error
 	if _, err = os.Stat(buildpropPath); err == nil {
 		// Read ro.vendor.build.version.release_or_codename from build.prop
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fde_fs/logger"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// setLogLevel persists the level and asks the running fde_fs and fde_ptfs
+// daemons to pick it up.
+func setLogLevel(levelStr string) error {
+	level, err := logger.ParseLevel(levelStr)
+	if err != nil {
+		return err
+	}
+	if err = logger.SaveLevel(level); err != nil {
+		logger.Error("save_log_level", levelStr, err)
+		return err
+	}
+	reloadDaemonsLogLevel()
+	return nil
+}
+
+// reloadDaemonsLogLevel sends SIGHUP to the mounting fde_fs processes and to
+// every fde_ptfs, which re-read log.level from config.SystemFile on it.
+func reloadDaemonsLogLevel() {
+	pids, err := filepath.Glob("/proc/[0-9]*")
+	if err != nil {
+		return
+	}
+	selfPID := os.Getpid()
+	for _, dir := range pids {
+		pid, err := strconv.Atoi(filepath.Base(dir))
+		if err != nil || pid == selfPID {
+			continue
+		}
+		comm, err := os.ReadFile(filepath.Join(dir, "comm"))
+		if err != nil {
+			continue
+		}
+		switch strings.TrimSpace(string(comm)) {
+		case "fde_ptfs":
+		case "fde_fs":
+			//only the daemons handle SIGHUP, it would terminate the other commands
+			cmdline, err := os.ReadFile(filepath.Join(dir, "cmdline"))
+			if err != nil || !isDaemonCmdline(strings.Split(string(cmdline), "\x00")) {
+				continue
+			}
+		default:
+			continue
+		}
+		if err := syscall.Kill(pid, syscall.SIGHUP); err != nil {
+			logger.Error("send_sighup_failed", pid, err)
+		} else {
+			logger.Info("send_sighup_success", pid)
+		}
+	}
+}
+
+// isDaemonCmdline tells whether args, program name included, run "mount" or
+// "ptfs mount", or their former flags -m and -pm.
+func isDaemonCmdline(args []string) bool {
+	if len(args) > 1 && args[1] == "mount" {
+		return true
+	}
+	if len(args) > 2 && args[1] == "ptfs" && args[2] == "mount" {
+		return true
+	}
+	for _, arg := range args {
+		if arg == "-m" || arg == "-pm" {
+			return true
+		}
+	}
+	return false
+}
@@ -1,12 +1,22 @@
 package main
 
 import (
+	"fde_fs/mountinfo"
 	"io/fs"
 	"reflect"
 	"testing"
 	"time"
 )
 
+func parseMounts(t *testing.T, mounts []byte) []mountinfo.Mount {
+	t.Helper()
+	parsed, err := mountinfo.Parse(mounts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
+
 // type FileInfo interface {
 // 	Name() string       // base name of the file
 // 	Size() int64        // length in bytes for regular files; system-dependent for others
@@ -48,6 +58,11 @@ func Test_readDevicesAndMountPoint(t *testing.T) {
 		"36 29 8:5 /home /home rw,relatime shared:8 - ext4 /dev/sda5 rw\n" +
 			"35 29 8:5 / / rw,relatime shared:7 - ext4 /dev/sda5 rw\n" +
 			"807 790 7:1 / /var/lib/waydroid/rootfs/vendor ro,relatime shared:446 - ext4 /dev/loop1 ro"
+	lvmAndBtrfsMounts :=
+		"29 1 252:0 / / rw,relatime shared:1 - ext4 /dev/mapper/vg-root rw\n" +
+			"40 29 0:27 /@data /data rw,relatime shared:3 - btrfs /dev/nvme0n1p2 rw,subvol=/@data\n" +
+			"31 29 0:27 /@home /home rw,relatime shared:2 - btrfs /dev/nvme0n1p2 rw,subvol=/@home\n" +
+			"50 29 0:45 / /mnt rw,relatime shared:4 - nfs server:/export rw"
 
 	type args struct {
 		mounts []byte
@@ -65,9 +80,31 @@ func Test_readDevicesAndMountPoint(t *testing.T) {
 				mounts: []byte(selfmounts),
 			},
 			want: map[string]volumeAndMountPoint{
-				"/dev/sda5": {
+				"8:5": {
 					MountPoint: "/",
 					MountID:    "35",
+					MountType:  "ext4",
+					Device:     "/dev/sda5",
+				},
+			},
+		},
+		{
+			name: "lvm and btrfs",
+			args: args{
+				mounts: []byte(lvmAndBtrfsMounts),
+			},
+			want: map[string]volumeAndMountPoint{
+				"252:0": {
+					MountPoint: "/",
+					MountID:    "29",
+					MountType:  "ext4",
+					Device:     "/dev/mapper/vg-root",
+				},
+				"0:27": {
+					MountPoint: "/home",
+					MountID:    "31",
+					MountType:  "btrfs",
+					Device:     "/dev/nvme0n1p2",
 				},
 			},
 		},
@@ -75,7 +112,7 @@ func Test_readDevicesAndMountPoint(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := readDevicesAndMountPoint(tt.args.mounts); !reflect.DeepEqual(got, tt.want) {
+			if got := readDevicesAndMountPoint(parseMounts(t, tt.args.mounts)); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("readDevicesAndMountPoint() = %v, want %v", got, tt.want)
 			}
 		})
@@ -105,9 +142,11 @@ func Test_readDevicesAndMountPoint1(t *testing.T) {
 				mounts: []byte(multiMounts),
 			},
 			want: map[string]volumeAndMountPoint{
-				"/dev/sda5": {
+				"8:5": {
 					MountPoint: "/data",
 					MountID:    "34",
+					MountType:  "ext4",
+					Device:     "/dev/sda5",
 				},
 			},
 		},
@@ -115,7 +154,7 @@ func Test_readDevicesAndMountPoint1(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := readDevicesAndMountPoint(tt.args.mounts); !reflect.DeepEqual(got, tt.want) {
+			if got := readDevicesAndMountPoint(parseMounts(t, tt.args.mounts)); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("readDevicesAndMountPoint() = %v, want %v", got, tt.want)
 			}
 		})
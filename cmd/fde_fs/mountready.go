@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"fde_fs/shutdown"
+	"fmt"
+	"syscall"
+	"time"
+
+	"github.com/winfsp/cgofuse/fuse"
+)
+
+// fuseSuperMagic is the statfs type of the fuse file systems.
+const fuseSuperMagic = 0x65735546
+
+var (
+	// mountReadyTimeout is how long a volume gets to appear once mounted
+	mountReadyTimeout = 10 * time.Second
+	// mountReadyPoll is how often the mount point is checked meanwhile
+	mountReadyPoll = 50 * time.Millisecond
+)
+
+var errMountReturned = errors.New("file system returned before being ready")
+
+// mountResult is the outcome of a mount, err being nil once it is ready.
+type mountResult struct {
+	target  string
+	elapsed time.Duration
+	err     error
+}
+
+// isFuseMount reports whether path is the root of a fuse file system.
+func isFuseMount(path string) bool {
+	var st syscall.Statfs_t
+	return syscall.Statfs(path, &st) == nil && st.Type == fuseSuperMagic
+}
+
+// waitMountReady waits for target to be served by fuse. It fails when the
+// file system returned first, returned being closed, or after
+// mountReadyTimeout.
+func waitMountReady(target string, returned <-chan struct{}) mountResult {
+	start := time.Now()
+	deadline := time.NewTimer(mountReadyTimeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(mountReadyPoll)
+	defer ticker.Stop()
+	for {
+		if isFuseMount(target) {
+			return mountResult{target: target, elapsed: time.Since(start)}
+		}
+		select {
+		case <-returned:
+			return mountResult{target: target, elapsed: time.Since(start), err: errMountReturned}
+		case <-deadline.C:
+			return mountResult{target: target, elapsed: time.Since(start),
+				err: fmt.Errorf("not ready after %v", mountReadyTimeout)}
+		case <-ticker.C:
+		}
+	}
+}
+
+var (
+	// mountAttempts bounds the attempts at mounting a volume
+	mountAttempts = 5
+	// mountBackoff is the wait before retrying a mount, doubled after each
+	// failure up to mountBackoffMax
+	mountBackoff    = time.Second
+	mountBackoffMax = time.Minute
+)
+
+var errShuttingDown = errors.New("shutting down")
+
+// serveVolume mounts a volume and serves it until it is unmounted. A mount
+// which does not get ready is retried with backoff, the other volumes being
+// served meanwhile. The outcome of the first attempt is sent on first, and
+// false is returned when the volume could not be mounted at all.
+func serveVolume(value MountArgs, mounts *shutdown.Group, status *mountStatus, first chan<- mountResult) bool {
+	target := value.Args[len(value.Args)-1]
+	backoff := mountBackoff
+	for attempt := 1; ; attempt++ {
+		status.set(target, stateMounting, attempt, nil)
+		fs := value.PassFS
+		host := fuse.NewFileSystemHost(fs.fileSystem())
+		mount, ok := mounts.Add(target, func() { host.Unmount() })
+		if !ok {
+			if attempt == 1 {
+				first <- mountResult{target: target, err: errShuttingDown}
+			}
+			return true
+		}
+		returned := make(chan struct{})
+		go func() {
+			//Mount returns once the in-flight operations are over
+			defer mount.Done()
+			defer close(returned)
+			log := volumesLog.Op("mount").With("args", value.Args, "root", fs.root, "attempt", attempt)
+			log.Info("mount_volume")
+			if !host.Mount("", value.Args) {
+				log.Error("mount_fuse_error")
+			}
+		}()
+		result := waitMountReady(target, returned)
+		if attempt == 1 {
+			first <- result
+		}
+		if result.err == nil {
+			volumesLog.Info("mount_ready", "path", target, "elapsed", result.elapsed, "attempt", attempt)
+			status.set(target, stateMounted, attempt, nil)
+			<-returned
+			mounts.Remove(mount)
+			status.set(target, stateUnmounted, attempt, nil)
+			return true
+		}
+		volumesLog.WithError(result.err).Error("mount_not_ready", "path", target, "elapsed", result.elapsed, "attempt", attempt)
+		//a mount hanging before getting ready must be gone before the next one
+		if err := mount.Detach(); err != nil {
+			volumesLog.WithError(err).Error("mount_abandon_failed", "path", target)
+			status.set(target, stateFailed, attempt, err)
+			return false
+		}
+		mounts.Remove(mount)
+		if attempt >= mountAttempts {
+			volumesLog.Error("mount_give_up", "path", target, "attempts", attempt)
+			status.set(target, stateFailed, attempt, result.err)
+			return false
+		}
+		status.set(target, stateRetrying, attempt, result.err)
+		time.Sleep(backoff)
+		backoff = min(2*backoff, mountBackoffMax)
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func Test_waitMountReady(t *testing.T) {
+	defer func(timeout time.Duration) { mountReadyTimeout = timeout }(mountReadyTimeout)
+	mountReadyTimeout = 100 * time.Millisecond
+	dir := t.TempDir()
+
+	returned := make(chan struct{})
+	close(returned)
+	if got := waitMountReady(dir, returned); !errors.Is(got.err, errMountReturned) {
+		t.Errorf("waitMountReady() returned file system, err = %v", got.err)
+	}
+	if got := waitMountReady(dir, make(chan struct{})); got.err == nil || got.elapsed < mountReadyTimeout {
+		t.Errorf("waitMountReady() hung file system = %+v, want a timeout", got)
+	}
+	if isFuseMount(dir) {
+		t.Errorf("isFuseMount(%s) = true", dir)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MountStatusName is the file, next to .fde_path_key, telling fde_ctrl how
+// the mounts of the running fde_fs are doing, so it can show the failures.
+const MountStatusName = ".fde_mount_status"
+
+type volumeState string
+
+const (
+	stateMounting  volumeState = "mounting"
+	stateMounted   volumeState = "mounted"
+	stateRetrying  volumeState = "retrying"
+	stateFailed    volumeState = "failed"
+	stateUnmounted volumeState = "unmounted"
+)
+
+type volumeStatus struct {
+	Path     string
+	State    volumeState
+	Attempts int
+	Error    string `json:",omitempty"`
+	Updated  time.Time
+}
+
+type mountStatusFile struct {
+	Pid     int
+	Volumes []volumeStatus
+}
+
+// mountStatus keeps the status file up to date with the state of each
+// volume.
+type mountStatus struct {
+	mu      sync.Mutex
+	file    string
+	volumes map[string]*volumeStatus
+}
+
+func newMountStatus(file string) *mountStatus {
+	return &mountStatus{file: file, volumes: make(map[string]*volumeStatus)}
+}
+
+// set records the state of the volume mounted on path, err telling why it
+// is not mounted, and rewrites the file.
+func (s *mountStatus) set(path string, state volumeState, attempts int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := &volumeStatus{Path: path, State: state, Attempts: attempts, Updated: time.Now()}
+	if err != nil {
+		status.Error = err.Error()
+	}
+	s.volumes[path] = status
+	s.write()
+}
+
+// unmounted records that the volumes are not mounted anymore when exiting,
+// except those of stuck which could not be detached.
+func (s *mountStatus) unmounted(stuck []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, status := range s.volumes {
+		if status.State == stateMounted || status.State == stateMounting {
+			status.State = stateUnmounted
+			status.Updated = time.Now()
+		}
+	}
+	for _, path := range stuck {
+		if status, ok := s.volumes[path]; ok {
+			status.State = stateFailed
+			status.Error = "could not be unmounted"
+		}
+	}
+	s.write()
+}
+
+// write replaces the file, fde_ctrl never reading it half written.
+func (s *mountStatus) write() {
+	content := mountStatusFile{Pid: os.Getpid(), Volumes: make([]volumeStatus, 0, len(s.volumes))}
+	for _, status := range s.volumes {
+		content.Volumes = append(content.Volumes, *status)
+	}
+	sort.Slice(content.Volumes, func(i, j int) bool {
+		return content.Volumes[i].Path < content.Volumes[j].Path
+	})
+	tmp := filepath.Join(filepath.Dir(s.file), "."+filepath.Base(s.file)+".tmp")
+	err := WriteJSONToFile(tmp, content)
+	if err == nil {
+		err = os.Rename(tmp, s.file)
+	}
+	if err != nil {
+		volumesLog.WithError(err).Error("write_mount_status", "path", s.file)
+	}
+}
+
+// readMountStatus reads the status file written by the running fde_fs.
+func readMountStatus(file string) (*mountStatusFile, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var content mountStatusFile
+	if err := json.Unmarshal(data, &content); err != nil {
+		return nil, err
+	}
+	return &content, nil
+}
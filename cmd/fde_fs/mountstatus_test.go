@@ -0,0 +1,37 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func Test_mountStatus(t *testing.T) {
+	file := filepath.Join(t.TempDir(), MountStatusName)
+	status := newMountStatus(file)
+	status.set("/b", stateMounted, 1, nil)
+	status.set("/a", stateRetrying, 2, errors.New("not ready"))
+
+	content, err := readMountStatus(file)
+	if err != nil {
+		t.Fatalf("readMountStatus() error = %v", err)
+	}
+	if len(content.Volumes) != 2 || content.Volumes[0].Path != "/a" || content.Volumes[1].Path != "/b" {
+		t.Fatalf("readMountStatus() volumes = %+v, want /a then /b", content.Volumes)
+	}
+	if got := content.Volumes[0]; got.State != stateRetrying || got.Attempts != 2 || got.Error != "not ready" {
+		t.Errorf("readMountStatus() /a = %+v", got)
+	}
+
+	status.unmounted([]string{"/c"})
+	content, err = readMountStatus(file)
+	if err != nil {
+		t.Fatalf("readMountStatus() error = %v", err)
+	}
+	if got := content.Volumes[1].State; got != stateUnmounted {
+		t.Errorf("readMountStatus() /b state = %s, want %s", got, stateUnmounted)
+	}
+	if got := content.Volumes[0].State; got != stateRetrying {
+		t.Errorf("readMountStatus() /a state = %s, want %s", got, stateRetrying)
+	}
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/winfsp/cgofuse/fuse"
+)
+
+// netFS serves a network volume, running each operation of Ptfs on its own
+// goroutine: an operation the server does not answer within the timeout
+// fails with EIO instead of holding a FUSE thread. The volume is then
+// unreachable, its operations failing at once, until a statfs of its root
+// answers again.
+type netFS struct {
+	*Ptfs
+	timeout time.Duration
+	down    atomic.Bool
+}
+
+// fileSystem returns what serves the volume to FUSE.
+func (self *Ptfs) fileSystem() fuse.FileSystemInterface {
+	if self.netTimeout > 0 {
+		return &netFS{Ptfs: self, timeout: self.netTimeout}
+	}
+	return self
+}
+
+func (self *netFS) Init() {
+	self.Ptfs.Init()
+	//the copies serving the operations cannot record it for the others
+	self.recordNameSpace()
+}
+
+// netCall runs call on a copy of the Ptfs knowing the caller, and returns
+// false when the volume is unreachable or call timed out. abandoned, if not
+// nil, gets the result of a call returning after the timeout, to release
+// what it opened.
+func netCall[T any](self *netFS, op, path string, always bool, call func(fs *Ptfs) T, abandoned func(T)) (T, bool) {
+	var zero T
+	if !always && self.down.Load() {
+		return zero, false
+	}
+	uid, gid, pid := self.getcontext()
+	fs := *self.Ptfs
+	fs.caller = &caller{uid: uid, gid: gid, pid: pid}
+
+	var mu sync.Mutex
+	gaveUp := false
+	result := make(chan T, 1)
+	go func() {
+		r := call(&fs)
+		mu.Lock()
+		defer mu.Unlock()
+		if gaveUp {
+			if abandoned != nil {
+				abandoned(r)
+			}
+			return
+		}
+		result <- r
+	}()
+	timer := time.NewTimer(self.timeout)
+	defer timer.Stop()
+	select {
+	case r := <-result:
+		return r, true
+	case <-timer.C:
+	}
+	mu.Lock()
+	select {
+	case r := <-result:
+		mu.Unlock()
+		return r, true
+	default:
+		gaveUp = true
+	}
+	mu.Unlock()
+	self.unreachable(op, path)
+	return zero, false
+}
+
+func (self *netFS) unreachable(op, path string) {
+	if !self.down.CompareAndSwap(false, true) {
+		return
+	}
+	ptfsLog.Op(op).Warn("network_volume_unreachable", "root", self.root, "path", path, "timeout", self.timeout)
+	go self.probe()
+}
+
+// probe waits for the server to answer a statfs of the root again, a single
+// request being blocked on it meanwhile.
+func (self *netFS) probe() {
+	for {
+		var st syscall.Statfs_t
+		err := syscall.Statfs(self.root, &st)
+		if err == nil {
+			self.down.Store(false)
+			ptfsLog.Info("network_volume_reachable", "root", self.root)
+			return
+		}
+		time.Sleep(self.timeout)
+	}
+}
+
+var eio = -int(syscall.EIO)
+
+type fhResult struct {
+	errc int
+	fh   uint64
+}
+
+// closeAbandoned closes the file a call opened after its timeout.
+func closeAbandoned(r fhResult) {
+	if r.errc == 0 {
+		syscall.Close(int(r.fh))
+	}
+}
+
+func (self *netFS) errc(op, path string, call func(fs *Ptfs) int) int {
+	errc, ok := netCall(self, op, path, false, call, nil)
+	if !ok {
+		return eio
+	}
+	return errc
+}
+
+func (self *netFS) fh(op, path string, call func(fs *Ptfs) (int, uint64)) (int, uint64) {
+	r, ok := netCall(self, op, path, false, func(fs *Ptfs) fhResult {
+		errc, fh := call(fs)
+		return fhResult{errc: errc, fh: fh}
+	}, closeAbandoned)
+	if !ok {
+		return eio, ^uint64(0)
+	}
+	return r.errc, r.fh
+}
+
+func (self *netFS) Statfs(path string, stat *fuse.Statfs_t) int {
+	var st fuse.Statfs_t
+	errc := self.errc("statfs", path, func(fs *Ptfs) int { return fs.Statfs(path, &st) })
+	if errc == 0 {
+		*stat = st
+	}
+	return errc
+}
+
+func (self *netFS) Access(path string, mask uint32) int {
+	return self.errc("access", path, func(fs *Ptfs) int { return fs.Access(path, mask) })
+}
+
+func (self *netFS) Mknod(path string, mode uint32, dev uint64) int {
+	return self.errc("mknod", path, func(fs *Ptfs) int { return fs.Mknod(path, mode, dev) })
+}
+
+func (self *netFS) Mkdir(path string, mode uint32) int {
+	return self.errc("mkdir", path, func(fs *Ptfs) int { return fs.Mkdir(path, mode) })
+}
+
+func (self *netFS) Unlink(path string) int {
+	return self.errc("unlink", path, func(fs *Ptfs) int { return fs.Unlink(path) })
+}
+
+func (self *netFS) Rmdir(path string) int {
+	return self.errc("rmdir", path, func(fs *Ptfs) int { return fs.Rmdir(path) })
+}
+
+func (self *netFS) Link(oldpath string, newpath string) int {
+	return self.errc("link", newpath, func(fs *Ptfs) int { return fs.Link(oldpath, newpath) })
+}
+
+func (self *netFS) Symlink(target string, newpath string) int {
+	return self.errc("symlink", newpath, func(fs *Ptfs) int { return fs.Symlink(target, newpath) })
+}
+
+func (self *netFS) Readlink(path string) (int, string) {
+	type readlinkResult struct {
+		errc   int
+		target string
+	}
+	r, ok := netCall(self, "readlink", path, false, func(fs *Ptfs) readlinkResult {
+		errc, target := fs.Readlink(path)
+		return readlinkResult{errc: errc, target: target}
+	}, nil)
+	if !ok {
+		return eio, ""
+	}
+	return r.errc, r.target
+}
+
+func (self *netFS) Rename(oldpath string, newpath string) int {
+	return self.errc("rename", newpath, func(fs *Ptfs) int { return fs.Rename(oldpath, newpath) })
+}
+
+func (self *netFS) Chmod(path string, mode uint32) int {
+	return self.errc("chmod", path, func(fs *Ptfs) int { return fs.Chmod(path, mode) })
+}
+
+func (self *netFS) Chown(path string, uid uint32, gid uint32) int {
+	return self.errc("chown", path, func(fs *Ptfs) int { return fs.Chown(path, uid, gid) })
+}
+
+func (self *netFS) Utimens(path string, tmsp []fuse.Timespec) int {
+	tmsp = append([]fuse.Timespec(nil), tmsp...)
+	return self.errc("utimens", path, func(fs *Ptfs) int { return fs.Utimens(path, tmsp) })
+}
+
+func (self *netFS) Create(path string, flags int, mode uint32) (int, uint64) {
+	return self.fh("create", path, func(fs *Ptfs) (int, uint64) { return fs.Create(path, flags, mode) })
+}
+
+func (self *netFS) Open(path string, flags int) (int, uint64) {
+	return self.fh("open", path, func(fs *Ptfs) (int, uint64) { return fs.Open(path, flags) })
+}
+
+func (self *netFS) Getattr(path string, stat *fuse.Stat_t, fh uint64) int {
+	var st fuse.Stat_t
+	errc := self.errc("getattr", path, func(fs *Ptfs) int { return fs.Getattr(path, &st, fh) })
+	if errc == 0 {
+		*stat = st
+	}
+	return errc
+}
+
+func (self *netFS) Truncate(path string, size int64, fh uint64) int {
+	return self.errc("truncate", path, func(fs *Ptfs) int { return fs.Truncate(path, size, fh) })
+}
+
+// Read reads into a buffer of its own, the one of FUSE being gone if the
+// call times out.
+func (self *netFS) Read(path string, buff []byte, ofst int64, fh uint64) int {
+	data := make([]byte, len(buff))
+	n := self.errc("read", path, func(fs *Ptfs) int { return fs.Read(path, data, ofst, fh) })
+	if n > 0 {
+		copy(buff, data[:n])
+	}
+	return n
+}
+
+func (self *netFS) Write(path string, buff []byte, ofst int64, fh uint64) int {
+	data := append([]byte(nil), buff...)
+	return self.errc("write", path, func(fs *Ptfs) int { return fs.Write(path, data, ofst, fh) })
+}
+
+// Release closes the file even when the volume is unreachable, the close
+// finishing in the background if it times out.
+func (self *netFS) Release(path string, fh uint64) int {
+	errc, ok := netCall(self, "release", path, true, func(fs *Ptfs) int { return fs.Release(path, fh) }, nil)
+	if !ok {
+		return eio
+	}
+	return errc
+}
+
+func (self *netFS) Fsync(path string, datasync bool, fh uint64) int {
+	return self.errc("fsync", path, func(fs *Ptfs) int { return fs.Fsync(path, datasync, fh) })
+}
+
+func (self *netFS) Opendir(path string) (int, uint64) {
+	return self.fh("opendir", path, func(fs *Ptfs) (int, uint64) { return fs.Opendir(path) })
+}
+
+type dirEntry struct {
+	name string
+	stat *fuse.Stat_t
+	ofst int64
+}
+
+// Readdir lists the directory on another goroutine, then fills the buffer
+// of FUSE with the entries.
+func (self *netFS) Readdir(path string,
+	fill func(name string, stat *fuse.Stat_t, ofst int64) bool,
+	ofst int64,
+	fh uint64) int {
+	type readdirResult struct {
+		errc    int
+		entries []dirEntry
+	}
+	r, ok := netCall(self, "readdir", path, false, func(fs *Ptfs) readdirResult {
+		var entries []dirEntry
+		errc := fs.Readdir(path, func(name string, stat *fuse.Stat_t, ofst int64) bool {
+			entry := dirEntry{name: name, ofst: ofst}
+			if stat != nil {
+				st := *stat
+				entry.stat = &st
+			}
+			entries = append(entries, entry)
+			return true
+		}, ofst, fh)
+		return readdirResult{errc: errc, entries: entries}
+	}, nil)
+	if !ok {
+		return eio
+	}
+	for _, entry := range r.entries {
+		if !fill(entry.name, entry.stat, entry.ofst) {
+			break
+		}
+	}
+	return r.errc
+}
+
+func (self *netFS) Releasedir(path string, fh uint64) int {
+	errc, ok := netCall(self, "releasedir", path, true, func(fs *Ptfs) int { return fs.Releasedir(path, fh) }, nil)
+	if !ok {
+		return eio
+	}
+	return errc
+}
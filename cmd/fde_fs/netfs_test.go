@@ -0,0 +1,68 @@
+package main
+
+import (
+	"syscall"
+	"testing"
+	"time"
+)
+
+func newTestNetFS(root string) *netFS {
+	//a caller, fuse.Getcontext only works while serving FUSE
+	fs := &Ptfs{root: root, netTimeout: 50 * time.Millisecond, caller: &caller{}}
+	return fs.fileSystem().(*netFS)
+}
+
+func Test_netFS_timeout(t *testing.T) {
+	//the root does not exist, the probe never finds it reachable again
+	fs := newTestNetFS("/nonexistent/share")
+	if errc := fs.errc("getattr", "/", func(*Ptfs) int { return 0 }); errc != 0 {
+		t.Fatalf("errc() = %d, want 0", errc)
+	}
+
+	release := make(chan struct{})
+	abandoned := make(chan fhResult, 1)
+	start := time.Now()
+	_, ok := netCall(fs, "open", "/f", false, func(*Ptfs) fhResult {
+		<-release
+		return fhResult{fh: 42}
+	}, func(r fhResult) { abandoned <- r })
+	if ok || time.Since(start) < fs.timeout {
+		t.Fatalf("netCall() of a hung server = %v after %v, want a timeout", ok, time.Since(start))
+	}
+	close(release)
+	if r := <-abandoned; r.fh != 42 {
+		t.Errorf("abandoned() = %+v, want the late result", r)
+	}
+
+	//unreachable: failing at once, but the files are still closed
+	start = time.Now()
+	if errc := fs.errc("getattr", "/", func(*Ptfs) int { return 0 }); errc != -int(syscall.EIO) || time.Since(start) >= fs.timeout {
+		t.Errorf("errc() while unreachable = %d after %v, want EIO at once", errc, time.Since(start))
+	}
+	if errc, ok := netCall(fs, "release", "/f", true, func(*Ptfs) int { return 0 }, nil); !ok || errc != 0 {
+		t.Errorf("netCall() of release while unreachable = %d, %v", errc, ok)
+	}
+}
+
+func Test_netFS_reachableAgain(t *testing.T) {
+	fs := newTestNetFS(t.TempDir())
+	fs.unreachable("getattr", "/")
+	deadline := time.Now().Add(time.Second)
+	for fs.down.Load() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if fs.down.Load() {
+		t.Error("netFS still unreachable after its root answered")
+	}
+}
+
+func Test_Ptfs_fileSystem(t *testing.T) {
+	net := &Ptfs{root: t.TempDir(), netTimeout: time.Second}
+	if _, ok := net.fileSystem().(*netFS); !ok {
+		t.Error("fileSystem() of a network volume is not a netFS")
+	}
+	local := &Ptfs{root: t.TempDir()}
+	if local.fileSystem() != local {
+		t.Error("fileSystem() of a local volume is not the Ptfs")
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fde_fs/mountinfo"
+	"strconv"
+	"strings"
+)
+
+// networkFSTypes are the network file systems exported when volumes.network
+// is set.
+var networkFSTypes = map[string]bool{
+	"nfs":        true,
+	"nfs4":       true,
+	"cifs":       true,
+	"smb3":       true,
+	"fuse.sshfs": true,
+}
+
+// networkVolumePrefix starts the ids of the network volumes, which have no
+// uuid.
+const networkVolumePrefix = "net-"
+
+// networkVolumeID returns a stable id for the share source mounted on
+// mountPoint, naming its directory under VolumesPathPrefix.
+func networkVolumeID(source, mountPoint string) string {
+	sum := sha256.Sum256([]byte(source + "\x00" + mountPoint))
+	return networkVolumePrefix + hex.EncodeToString(sum[:8])
+}
+
+// readNetworkMounts returns the network shares of mountinfo, keyed by their
+// id.
+func readNetworkMounts(mounts []mountinfo.Mount) map[string]volumeAndMountPoint {
+	shares := make(map[string]volumeAndMountPoint)
+	for _, m := range mounts {
+		//below are line examples of the mountinfo
+		//120 29 0:53 / /mnt/projects rw,relatime shared:60 - nfs4 nas:/export/projects rw,vers=4.2
+		//121 29 0:54 / /mnt/share rw,relatime shared:61 - cifs //nas/share rw,vers=3.1.1
+		if !networkFSTypes[m.FSType] {
+			continue
+		}
+		//our own mounts are not exported again
+		if strings.HasPrefix(m.MountPoint, VolumesPathPrefix) {
+			continue
+		}
+		id := networkVolumeID(m.Source, m.MountPoint)
+		shares[id] = volumeAndMountPoint{
+			VolumeUUID: id,
+			MountPoint: m.MountPoint,
+			MountID:    strconv.Itoa(m.ID),
+			MountType:  m.FSType,
+			Device:     m.Source,
+			Network:    true,
+		}
+	}
+	return shares
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_readNetworkMounts(t *testing.T) {
+	mounts := "29 1 252:0 / / rw,relatime shared:1 - ext4 /dev/mapper/vg-root rw\n" +
+		"120 29 0:53 / /mnt/projects rw,relatime shared:60 - nfs4 nas:/export/projects rw,vers=4.2\n" +
+		"121 29 0:54 / /mnt/share rw,relatime shared:61 - cifs //nas/share rw,vers=3.1.1\n" +
+		"122 29 0:55 / " + VolumesPathPrefix + "net-0123456789abcdef rw,relatime shared:62 - fuse.sshfs me@host:/ rw\n" +
+		"123 29 0:56 / /run/user/1000/gvfs rw,relatime shared:63 - fuse.gvfsd-fuse gvfsd-fuse rw"
+
+	got := readNetworkMounts(parseMounts(t, []byte(mounts)))
+	nfs := networkVolumeID("nas:/export/projects", "/mnt/projects")
+	cifs := networkVolumeID("//nas/share", "/mnt/share")
+	want := map[string]volumeAndMountPoint{
+		nfs: {
+			VolumeUUID: nfs,
+			MountPoint: "/mnt/projects",
+			MountID:    "120",
+			MountType:  "nfs4",
+			Device:     "nas:/export/projects",
+			Network:    true,
+		},
+		cifs: {
+			VolumeUUID: cifs,
+			MountPoint: "/mnt/share",
+			MountID:    "121",
+			MountType:  "cifs",
+			Device:     "//nas/share",
+			Network:    true,
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("readNetworkMounts() = %v, want %v", got, want)
+	}
+}
+
+func Test_networkVolumeID(t *testing.T) {
+	id := networkVolumeID("nas:/export", "/mnt/a")
+	if id != networkVolumeID("nas:/export", "/mnt/a") {
+		t.Error("networkVolumeID() is not stable")
+	}
+	if id == networkVolumeID("nas:/export", "/mnt/b") || id == networkVolumeID("nas:/expor", "t/mnt/a") {
+		t.Error("networkVolumeID() collides")
+	}
+	if len(id) != len(networkVolumePrefix)+16 {
+		t.Errorf("networkVolumeID() = %q", id)
+	}
+}
@@ -23,6 +23,7 @@ import (
 	"path/filepath"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/winfsp/cgofuse/examples/shared"
 	"github.com/winfsp/cgofuse/fuse"
@@ -84,16 +85,36 @@ var (
 	_host *fuse.FileSystemHost
 )
 
+var ptfsLog = logger.Component("ptfs")
+
+// requestLog starts the log of one FUSE request, the op_id ties together the
+// lines written while serving it.
+func (self *Ptfs) requestLog(op, path string) *logger.Entry {
+	uid, gid, pid := self.getcontext()
+	return ptfsLog.Op(op).With("root", self.original, "path", path, "uid", uid, "gid", gid, "pid", pid)
+}
+
 type Ptfs struct {
 	fuse.FileSystemBase
 	original string
 	ns       uint64
 	root     string
+	//android may only read the volume, the mutating operations fail with EROFS
+	readOnly bool
+	//the storage android may use, nil without a limit
+	quota *dataQuota
+	//a network file system, served by netFS with this timeout
+	netTimeout time.Duration
+	//set on the copies made by netFS
+	caller *caller
 }
 
 func (self *Ptfs) Init() {
 	defer trace()()
 	self.original = self.root
+	if self.quota != nil {
+		self.quota.mounted(self.root)
+	}
 	// e := syscall.Chdir(self.root)
 	//	if nil == e {
 	//		self.root = "./"
@@ -103,13 +124,16 @@ func (self *Ptfs) Init() {
 // Destroy is called when the file system is destroyed.
 // The FileSystemBase implementation does nothing.
 func (self *Ptfs) Destroy() {
+	if self.quota != nil {
+		self.quota.unmounted()
+	}
 }
 
 // Access checks file access permissions.
 // The FileSystemBase implementation returns -ENOSYS.
 func (self *Ptfs) Access(path string, mask uint32) int {
 	path = filepath.Join(self.root, path)
-	uid, gid, _ := fuse.Getcontext()
+	uid, gid, _ := self.getcontext()
 	rpath := path
 	if self.isHostNS() {
 		//accessing openfde
@@ -124,8 +148,7 @@ func (self *Ptfs) Access(path string, mask uint32) int {
 			copyFusestatFromGostat(&dstSt, &st)
 			if !validPermR(uint32(uid), st.Uid, gid, st.Gid, dstSt.Mode) {
 				//-1 means no permission
-				info := fmt.Sprint(uid, "=uid, ", st.Uid, "=fileuid, ", gid, "=gid", st.Gid, "=filegid")
-				logger.Info("open_dir", info)
+				self.requestLog("access", path).Info("open_dir", "file_uid", st.Uid, "file_gid", st.Gid)
 				return -int(syscall.EACCES)
 			} else {
 				//more mask need to checking , not just reading
@@ -147,11 +170,18 @@ func (self *Ptfs) Statfs(path string, stat *fuse.Statfs_t) (errc int) {
 	stgo := syscall.Statfs_t{}
 	errc = errno(syscall_Statfs(path, &stgo))
 	copyFusestatfsFromGostatfs(stat, &stgo)
+	self.quota.statfs(stat)
+	if self.readOnly {
+		stat.Flag |= stRdonly
+	}
 	return
 }
 
 func (self *Ptfs) Mknod(path string, mode uint32, dev uint64) (errc int) {
 	defer trace(path, mode, dev)(&errc)
+	if self.readOnly {
+		return -int(syscall.EROFS)
+	}
 	defer setuidgid()()
 	path = filepath.Join(self.root, path)
 	return errno(syscall.Mknod(path, mode, int(dev)))
@@ -165,18 +195,17 @@ func (self *Ptfs) isOpenfdeFileSystem() bool {
 	return false
 }
 
-func (self *Ptfs) haveWPerm() bool {
+func (self *Ptfs) haveWPerm(log *logger.Entry) bool {
 	dirList := strings.Split(self.original, LocalOpenfde)
 	home := dirList[0]
 	var st syscall.Stat_t
 	syscall.Stat(home, &st)
 	var dstSt fuse.Stat_t
 	copyFusestatFromGostat(&dstSt, &st)
-	uid, gid, _ := fuse.Getcontext()
+	uid, gid, _ := self.getcontext()
 	if !validPermW(uint32(uid), st.Uid, gid, st.Gid, dstSt.Mode) {
 		//-1 means no permission
-		info := fmt.Sprint(uid, "=uid, ", st.Uid, "=fileuid, ", gid, "=gid", st.Gid, "=filegid", "for_path", home)
-		logger.Warn("judge_w_permission", info)
+		log.Warn("judge_w_permission", "caller_uid", uid, "caller_gid", gid, "file_uid", st.Uid, "file_gid", st.Gid, "for_path", home)
 		return false
 	}
 	return true
@@ -184,8 +213,11 @@ func (self *Ptfs) haveWPerm() bool {
 
 func (self *Ptfs) Mkdir(path string, mode uint32) (errc int) {
 	defer trace(path, mode)(&errc)
+	if self.readOnly {
+		return -int(syscall.EROFS)
+	}
 	if self.isHostNS() && self.isOpenfdeFileSystem() {
-		if !self.haveWPerm() {
+		if !self.haveWPerm(self.requestLog("mkdir", path)) {
 			return -int(syscall.EACCES)
 		}
 		var st syscall.Stat_t
@@ -208,21 +240,39 @@ func (self *Ptfs) Mkdir(path string, mode uint32) (errc int) {
 
 func (self *Ptfs) Unlink(path string) (errc int) {
 	defer trace(path)(&errc)
+	if self.readOnly {
+		return -int(syscall.EROFS)
+	}
 	if self.isHostNS() && !self.isOpenfdeFileSystem() {
 		return -int(syscall.EACCES)
 	}
 	path = filepath.Join(self.root, path)
-	return errno(syscall.Unlink(path))
+	if self.quota == nil {
+		return errno(syscall.Unlink(path))
+	}
+	defer self.quota.lockFile(path, ^uint64(0))()
+	size, last, _ := sizeOf(path, ^uint64(0))
+	errc = errno(syscall.Unlink(path))
+	if errc == 0 && last {
+		self.quota.account(-size)
+	}
+	return
 }
 
 func (self *Ptfs) Rmdir(path string) (errc int) {
 	defer trace(path)(&errc)
+	if self.readOnly {
+		return -int(syscall.EROFS)
+	}
 	path = filepath.Join(self.root, path)
 	return errno(syscall.Rmdir(path))
 }
 
 func (self *Ptfs) Link(oldpath string, newpath string) (errc int) {
 	defer trace(oldpath, newpath)(&errc)
+	if self.readOnly {
+		return -int(syscall.EROFS)
+	}
 	defer setuidgid()()
 	oldpath = filepath.Join(self.root, oldpath)
 	newpath = filepath.Join(self.root, newpath)
@@ -231,6 +281,9 @@ func (self *Ptfs) Link(oldpath string, newpath string) (errc int) {
 
 func (self *Ptfs) Symlink(target string, newpath string) (errc int) {
 	defer trace(target, newpath)(&errc)
+	if self.readOnly {
+		return -int(syscall.EROFS)
+	}
 	defer setuidgid()()
 	newpath = filepath.Join(self.root, newpath)
 	return errno(syscall.Symlink(target, newpath))
@@ -249,26 +302,50 @@ func (self *Ptfs) Readlink(path string) (errc int, target string) {
 
 func (self *Ptfs) Rename(oldpath string, newpath string) (errc int) {
 	defer trace(oldpath, newpath)(&errc)
+	if self.readOnly {
+		return -int(syscall.EROFS)
+	}
 	defer setuidgid()()
 	oldpath = filepath.Join(self.root, oldpath)
 	newpath = filepath.Join(self.root, newpath)
-	return errno(syscall.Rename(oldpath, newpath))
+	if self.quota == nil {
+		return errno(syscall.Rename(oldpath, newpath))
+	}
+	//the file replaced by the rename is freed, unless it is the same
+	defer self.quota.lockFile(newpath, ^uint64(0))()
+	var oldSt, newSt syscall.Stat_t
+	replaced := syscall.Lstat(newpath, &newSt) == nil && syscall.Lstat(oldpath, &oldSt) == nil &&
+		newSt.Ino != oldSt.Ino && newSt.Mode&syscall.S_IFMT == syscall.S_IFREG && newSt.Nlink <= 1
+	errc = errno(syscall.Rename(oldpath, newpath))
+	if errc == 0 && replaced {
+		self.quota.account(-newSt.Size)
+	}
+	return
 }
 
 func (self *Ptfs) Chmod(path string, mode uint32) (errc int) {
 	defer trace(path, mode)(&errc)
+	if self.readOnly {
+		return -int(syscall.EROFS)
+	}
 	path = filepath.Join(self.root, path)
 	return errno(syscall.Chmod(path, mode))
 }
 
 func (self *Ptfs) Chown(path string, uid uint32, gid uint32) (errc int) {
 	defer trace(path, uid, gid)(&errc)
+	if self.readOnly {
+		return -int(syscall.EROFS)
+	}
 	path = filepath.Join(self.root, path)
 	return errno(syscall.Lchown(path, int(uid), int(gid)))
 }
 
 func (self *Ptfs) Utimens(path string, tmsp1 []fuse.Timespec) (errc int) {
 	defer trace(path, tmsp1)(&errc)
+	if self.readOnly {
+		return -int(syscall.EROFS)
+	}
 	path = filepath.Join(self.root, path)
 	tmsp := [2]syscall.Timespec{}
 	tmsp[0].Sec, tmsp[0].Nsec = tmsp1[0].Sec, tmsp1[0].Nsec
@@ -278,8 +355,11 @@ func (self *Ptfs) Utimens(path string, tmsp1 []fuse.Timespec) (errc int) {
 
 func (self *Ptfs) Create(path string, flags int, mode uint32) (errc int, fh uint64) {
 	defer trace(path, flags, mode)(&errc, &fh)
+	if self.readOnly {
+		return -int(syscall.EROFS), ^uint64(0)
+	}
 	if self.isHostNS() && self.isOpenfdeFileSystem() {
-		if !self.haveWPerm() {
+		if !self.haveWPerm(self.requestLog("create", path)) {
 			return -int(syscall.EACCES), 0
 		}
 		var st syscall.Stat_t
@@ -301,6 +381,9 @@ func (self *Ptfs) Create(path string, flags int, mode uint32) (errc int, fh uint
 
 func (self *Ptfs) Open(path string, flags int) (errc int, fh uint64) {
 	defer trace(path, flags)(&errc, &fh)
+	if self.readOnly && (flags&syscall.O_ACCMODE != syscall.O_RDONLY || flags&syscall.O_TRUNC != 0) {
+		return -int(syscall.EROFS), ^uint64(0)
+	}
 	var rpath string
 	//decide whether the home/xxx/openfde being able to accessed by the current user,
 	if self.isHostNS() {
@@ -321,11 +404,10 @@ func (self *Ptfs) Open(path string, flags int) (errc int, fh uint64) {
 		syscall.Stat(rpath, &st)
 		var dstSt fuse.Stat_t
 		copyFusestatFromGostat(&dstSt, &st)
-		uid, gid, _ := fuse.Getcontext()
+		uid, gid, _ := self.getcontext()
 		if !validPermR(uint32(uid), st.Uid, gid, st.Gid, dstSt.Mode) {
 			//-1 means no permission
-			info := fmt.Sprint(uid, "=uid, ", st.Uid, "=fileuid, ", gid, "=gid", st.Gid, "=filegid")
-			logger.Info("open", info)
+			self.requestLog("open", path).Info("open", "file_uid", st.Uid, "file_gid", st.Gid)
 			return -int(syscall.EACCES), 0
 		}
 
@@ -341,10 +423,18 @@ func (self *Ptfs) Open(path string, flags int) (errc int, fh uint64) {
 
 func (self *Ptfs) open(path string, flags int, mode uint32) (errc int, fh uint64) {
 	path = filepath.Join(self.root, path)
+	var truncated int64
+	if self.quota != nil && flags&syscall.O_TRUNC != 0 && flags&syscall.O_ACCMODE != syscall.O_RDONLY {
+		defer self.quota.lockFile(path, ^uint64(0))()
+		truncated, _, _ = sizeOf(path, ^uint64(0))
+	}
 	f, e := syscall.Open(path, flags, mode)
 	if nil != e {
 		return errno(e), ^uint64(0)
 	}
+	if truncated > 0 {
+		self.quota.account(-truncated)
+	}
 	return 0, uint64(f)
 }
 
@@ -363,12 +453,32 @@ func (self *Ptfs) Getattr(path string, stat *fuse.Stat_t, fh uint64) (errc int)
 
 func (self *Ptfs) Truncate(path string, size int64, fh uint64) (errc int) {
 	defer trace(path, size, fh)(&errc)
+	if self.readOnly {
+		return -int(syscall.EROFS)
+	}
 	if ^uint64(0) == fh {
 		path = filepath.Join(self.root, path)
+	}
+	var growth int64
+	if self.quota != nil {
+		defer self.quota.lockFile(path, fh)()
+		old, _, err := sizeOf(path, fh)
+		if err != nil {
+			return errno(err)
+		}
+		growth = size - old
+		if !self.quota.reserve(growth) {
+			return -int(syscall.ENOSPC)
+		}
+	}
+	if ^uint64(0) == fh {
 		errc = errno(syscall.Truncate(path, size))
 	} else {
 		errc = errno(syscall.Ftruncate(int(fh), size))
 	}
+	if errc != 0 && self.quota != nil {
+		self.quota.account(-growth)
+	}
 	return
 }
 
@@ -383,7 +493,38 @@ func (self *Ptfs) Read(path string, buff []byte, ofst int64, fh uint64) (n int)
 
 func (self *Ptfs) Write(path string, buff []byte, ofst int64, fh uint64) (n int) {
 	defer trace(path, buff, ofst, fh)(&n)
+	if self.readOnly {
+		return -int(syscall.EROFS)
+	}
+	if self.quota != nil {
+		return self.writeInQuota(buff, ofst, fh)
+	}
+	n, e := syscall.Pwrite(int(fh), buff, ofst)
+	if nil != e {
+		return errno(e)
+	}
+	return n
+}
+
+// writeInQuota writes unless the file would grow beyond the quota. The
+// growth expected is reserved first, then corrected by the size the file
+// has once written, the other writes of the file waiting meanwhile.
+func (self *Ptfs) writeInQuota(buff []byte, ofst int64, fh uint64) int {
+	defer self.quota.lockFile("", fh)()
+	old, _, err := sizeOf("", fh)
+	if err != nil {
+		return errno(err)
+	}
+	growth := max(ofst+int64(len(buff))-old, 0)
+	if !self.quota.reserve(growth) {
+		return -int(syscall.ENOSPC)
+	}
 	n, e := syscall.Pwrite(int(fh), buff, ofst)
+	size, _, err := sizeOf("", fh)
+	if err != nil {
+		size = old + growth
+	}
+	self.quota.account(size - old - growth)
 	if nil != e {
 		return errno(e)
 	}
@@ -403,7 +544,7 @@ func (self *Ptfs) Fsync(path string, datasync bool, fh uint64) (errc int) {
 func (self *Ptfs) Opendir(path string) (errc int, fh uint64) {
 	defer trace(path)(&errc, &fh)
 	path = filepath.Join(self.original, path)
-	uid, gid, _ := fuse.Getcontext()
+	uid, gid, _ := self.getcontext()
 	rpath := path
 	if self.isHostNS() {
 		//accessing openfde
@@ -419,8 +560,7 @@ func (self *Ptfs) Opendir(path string) (errc int, fh uint64) {
 		copyFusestatFromGostat(&dstSt, &st)
 		if !validPermR(uint32(uid), st.Uid, gid, st.Gid, dstSt.Mode) {
 			//-1 means no permission
-			info := fmt.Sprint(uid, "=uid, ", st.Uid, "=fileuid, ", gid, "=gid", st.Gid, "=filegid")
-			logger.Info("open_dir", info)
+			self.requestLog("opendir", path).Info("open_dir", "file_uid", st.Uid, "file_gid", st.Gid)
 			return -int(syscall.EACCES), 0
 		}
 	} else {
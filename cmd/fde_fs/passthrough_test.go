@@ -0,0 +1,72 @@
+package main
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/winfsp/cgofuse/fuse"
+)
+
+func TestPtfs_readOnly(t *testing.T) {
+	fs := &Ptfs{root: t.TempDir(), readOnly: true}
+	erofs := -int(syscall.EROFS)
+	tests := map[string]func() int{
+		"Mknod":    func() int { return fs.Mknod("/f", syscall.S_IFREG|0644, 0) },
+		"Mkdir":    func() int { return fs.Mkdir("/d", 0755) },
+		"Unlink":   func() int { return fs.Unlink("/f") },
+		"Rmdir":    func() int { return fs.Rmdir("/d") },
+		"Link":     func() int { return fs.Link("/f", "/g") },
+		"Symlink":  func() int { return fs.Symlink("/f", "/g") },
+		"Rename":   func() int { return fs.Rename("/f", "/g") },
+		"Chmod":    func() int { return fs.Chmod("/", 0700) },
+		"Chown":    func() int { return fs.Chown("/", 0, 0) },
+		"Utimens":  func() int { return fs.Utimens("/", make([]fuse.Timespec, 2)) },
+		"Truncate": func() int { return fs.Truncate("/f", 0, ^uint64(0)) },
+		"Write":    func() int { return fs.Write("/f", []byte("x"), 0, 0) },
+		"Create": func() int {
+			errc, _ := fs.Create("/f", syscall.O_WRONLY|syscall.O_CREAT, 0644)
+			return errc
+		},
+		"Open for writing": func() int {
+			errc, _ := fs.Open("/f", syscall.O_RDWR)
+			return errc
+		},
+		"Open truncating": func() int {
+			errc, _ := fs.Open("/f", syscall.O_RDONLY|syscall.O_TRUNC)
+			return errc
+		},
+	}
+	for name, op := range tests {
+		if got := op(); got != erofs {
+			t.Errorf("%s() = %d, want EROFS", name, got)
+		}
+	}
+
+	var stat fuse.Statfs_t
+	if errc := fs.Statfs("/", &stat); errc != 0 || stat.Flag&stRdonly == 0 {
+		t.Errorf("Statfs() = %d, flag %#x, want ST_RDONLY", errc, stat.Flag)
+	}
+	fs.readOnly = false
+	if errc := fs.Statfs("/", &stat); errc != 0 || stat.Flag&stRdonly != 0 {
+		t.Errorf("Statfs() writable = %d, flag %#x", errc, stat.Flag)
+	}
+}
+
+func TestPtfs_Statfs(t *testing.T) {
+	root := t.TempDir()
+	var want syscall.Statfs_t
+	if err := syscall.Statfs(root, &want); err != nil {
+		t.Fatal(err)
+	}
+	fs := &Ptfs{root: root, quota: newDataQuota(root, 1<<20)}
+	var got fuse.Statfs_t
+	if errc := fs.Statfs("/", &got); errc != 0 {
+		t.Fatalf("Statfs() = %d", errc)
+	}
+	if got.Frsize == 0 || got.Namemax != uint64(want.Namelen) || got.Flag&stValid != 0 {
+		t.Errorf("Statfs() = %+v, want the frsize and namelen of %+v", got, want)
+	}
+	if got.Blocks*got.Frsize > 1<<20 || got.Bavail > got.Bfree {
+		t.Errorf("Statfs() = %+v, want at most %d bytes", got, 1<<20)
+	}
+}
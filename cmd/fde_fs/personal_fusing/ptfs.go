@@ -3,10 +3,12 @@ package personal_fusing
 import (
 	"context"
 	"errors"
+	"fde_fs/config"
 	"fde_fs/inotify"
 	"fde_fs/logger"
+	"fde_fs/mountinfo"
+	"fde_fs/shutdown"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"os/exec"
 	"os/signal"
@@ -17,6 +19,8 @@ import (
 	"time"
 )
 
+var fusingLog = logger.Component("personal_fusing")
+
 const Media0 = "/media/0/"
 const LocalShareOpenfde = ".local/share/openfde"
 
@@ -26,17 +30,18 @@ func UmountPtfs(aospVer string) error {
 		localMedia0 := filepath.Join(localShareOpenfde, Media0)
 		home, err := os.UserHomeDir()
 		if err != nil {
-			logger.Error("mount_query_home_failed", os.Getuid(), err)
+			fusingLog.WithError(err).Error("mount_query_home_failed", "uid", os.Getuid())
 			return err
 		}
 		androidDir := filepath.Join(home, filepath.Join(localMedia0))
 		syscall.Setreuid(-1, 0)
 		umountsuccess := true
 		for _, dir := range androidDirList {
-			logger.Info("umount_volumes", filepath.Join(androidDir, dir))
-			err = syscall.Unmount(filepath.Join(androidDir, dir), 0)
+			target := filepath.Join(androidDir, dir)
+			fusingLog.Info("umount_volumes", "path", target)
+			err = logger.Wrap("unmount", target, syscall.Unmount(target, 0))
 			if err != nil {
-				logger.Error("umount_volumes", filepath.Join(androidDir, dir), err)
+				fusingLog.WithError(err).Error("umount_volumes", "path", target)
 				umountsuccess = false
 			}
 		}
@@ -44,12 +49,12 @@ func UmountPtfs(aospVer string) error {
 			return nil
 		}
 	}
-	logger.Info("kill_fde_ptfs", nil)
+	fusingLog.Info("kill_fde_ptfs")
 
-	// Find process "fde_fs -pm" via ps and send SIGTERM (15)
+	// Find process "fde_fs ptfs mount" or "fde_fs -pm" via ps and send SIGTERM (15)
 	out, err := exec.Command("ps", "-eo", "pid,command").Output()
 	if err != nil {
-		logger.Error("ps_list_failed", nil, err)
+		fusingLog.WithError(err).Error("ps_list_failed")
 		return err
 	}
 	selfPID := os.Getpid()
@@ -70,11 +75,11 @@ func UmountPtfs(aospVer string) error {
 			continue
 		}
 		cmdline := strings.Join(fields[1:], " ")
-		if strings.Contains(cmdline, "fde_fs") && strings.Contains(cmdline, " -pm") {
+		if strings.Contains(cmdline, "fde_fs") && (strings.Contains(cmdline, " -pm") || strings.Contains(cmdline, " ptfs mount")) {
 			if err := syscall.Kill(pid, syscall.SIGTERM); err != nil {
-				logger.Error("send_sigterm_failed", pid, err)
+				fusingLog.WithError(err).Error("send_sigterm_failed", "pid", pid)
 			} else {
-				logger.Info("send_sigterm_success", pid)
+				fusingLog.Info("send_sigterm_success", "pid", pid)
 			}
 		}
 	}
@@ -141,12 +146,12 @@ func getUserFolders(aospVer string) ([]string, []string, error) {
 			if os.IsNotExist(err) {
 				err = os.Mkdir(realLinuxDirList[i], os.ModeDir+0755)
 				if err != nil {
-					logger.Error("mkdir_personal_dir", realLinuxDirList[i], err)
+					fusingLog.WithError(err).Error("mkdir_personal_dir", "path", realLinuxDirList[i])
 					return nil, nil, err
 				}
 				err = os.Chown(realLinuxDirList[i], os.Getuid(), os.Getgid())
 				if err != nil {
-					logger.Error("chown_personal_dir", realLinuxDirList[i], err)
+					fusingLog.WithError(err).Error("chown_personal_dir", "path", realLinuxDirList[i])
 					return nil, nil, err
 				}
 			}
@@ -167,7 +172,7 @@ func mountFdePtfs(sourcePath, targetPath string) error {
 func queryPassThroughForWaydroid() bool {
 	out, err := exec.Command("ps", "-eo", "pid,command").Output()
 	if err != nil {
-		logger.Error("ps_list_failed", nil, err)
+		fusingLog.WithError(err).Error("ps_list_failed")
 		return false
 	}
 	var initPid string
@@ -184,34 +189,39 @@ func queryPassThroughForWaydroid() bool {
 		}
 	}
 	if initPid == "" {
-		logger.Error("init_second_stage_not_found", nil, nil)
+		fusingLog.Error("init_second_stage_not_found")
 		return false
 	}
-	mountsPath := fmt.Sprintf("/proc/%s/mounts", initPid)
-	mountsBytes, err := ioutil.ReadFile(mountsPath)
-	if err != nil {
-		logger.Error("read_init_mounts_failed", mountsPath, err)
+	mountsPath := fmt.Sprintf("/proc/%s/mountinfo", initPid)
+	mounts, err := mountinfo.ReadFile(mountsPath)
+	if errors.Is(err, mountinfo.ErrMalformed) {
+		fusingLog.WithError(err).Warn("read_init_mounts_failed", "path", mountsPath)
+	} else if err != nil {
+		fusingLog.WithError(err).Error("read_init_mounts_failed", "path", mountsPath)
 		return false
 	}
-	if strings.Contains(string(mountsBytes), "/mnt/pass_through/0/emulated") {
-		return true
+	for _, m := range mounts {
+		if strings.HasPrefix(m.MountPoint, "/mnt/pass_through/0/emulated") {
+			return true
+		}
 	}
 	return false
 }
 
 var fslock sync.Mutex
 
-const ptfsQueryName = "fuse.fde_ptfs"
+// PtfsQueryName is the file system type of the personal folder mounts.
+const PtfsQueryName = "fuse.fde_ptfs"
 
 func GetPtfs(aospVer string) (bool, error) {
 	_, randroidList, err := getUserFolders(aospVer)
 	if err != nil {
-		logger.Error("get_ptfs_get_user_forlders", nil, err)
+		fusingLog.WithError(err).Error("get_ptfs_get_user_forlders")
 		return false, err
 	}
 	mounted, _, err := getPtfs(len(randroidList))
 	if err != nil {
-		logger.Error("get_ptfs_query_proc", nil, err)
+		fusingLog.WithError(err).Error("get_ptfs_query_proc")
 		return false, err
 	}
 	return mounted, nil
@@ -219,19 +229,26 @@ func GetPtfs(aospVer string) (bool, error) {
 
 func getPtfs(ptfsCount int) (bool, int, error) {
 	fslock.Lock()
-	// Check if /proc/self/mounts contains "fde_ptfs" keyword
-	mounts, err := ioutil.ReadFile("/proc/self/mounts")
+	// Count the mounts of fde_ptfs
+	mounts, err := mountinfo.Read()
 	defer fslock.Unlock()
-	if err != nil {
-		logger.Error("read_mounts_file", nil, err)
+	if errors.Is(err, mountinfo.ErrMalformed) {
+		fusingLog.WithError(err).Warn("read_mounts_file")
+	} else if err != nil {
+		fusingLog.WithError(err).Error("read_mounts_file")
 		return false, 0, nil
 	}
-	ptfsActualCount := strings.Count(string(mounts), ptfsQueryName)
+	ptfsActualCount := 0
+	for _, m := range mounts {
+		if m.FSType == PtfsQueryName {
+			ptfsActualCount++
+		}
+	}
 	if ptfsActualCount >= ptfsCount {
-		logger.Info("count_ptfs", "more than "+fmt.Sprint(ptfsCount))
+		fusingLog.Info("count_ptfs", "actual", ptfsActualCount, "expected", ptfsCount)
 		out, err := exec.Command("ps", "-eo", "pid,ppid,comm").Output()
 		if err != nil {
-			logger.Error("ps_list_failed", nil, err)
+			fusingLog.WithError(err).Error("ps_list_failed")
 			return false, 0, err
 		}
 		have_proc_fde_ptfs := false
@@ -259,45 +276,54 @@ func getPtfs(ptfsCount int) (bool, int, error) {
 		}
 		return true, ptfsActualCount, nil
 	} else {
-		logger.Info("count_ptfs", "actualy is "+fmt.Sprint(strings.Count(string(mounts), ptfsQueryName)))
+		fusingLog.Info("count_ptfs", "actual", ptfsActualCount, "expected", ptfsCount)
 		return false, ptfsActualCount, nil
 	}
 }
 
-const applicationsDir = "/usr/share/applications"
+var applicationsDir = config.Get().Personal.ApplicationsDir
 
 func MountPtfs(aospVer string) error {
+	var mounts shutdown.Group
 	sigCh := make(chan os.Signal, 1)
 	waitingCh := make(chan struct{})
-	signal.Notify(sigCh, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	//SIGHUP reloads the log level, see logger.WatchLevelSignals
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 	go func() {
 		<-sigCh
-		logger.Info("sigterm_received", "umount ptfs mount")
-		if err := exec.Command("fde_fs", "-pu").Run(); err != nil {
-			logger.Error("sig_handler_fde_fs_pu_failed", nil, err)
+		fusingLog.Info("sigterm_received")
+		failed := mounts.Shutdown()
+		if len(failed) > 0 {
+			fusingLog.Error("shutdown_incomplete", "paths", failed)
+			logger.Sync()
+			os.Exit(1)
 		}
+		fusingLog.Info("shutdown_complete")
+		logger.Sync()
 		os.Exit(0)
 	}()
 	rlinuxList, randroidList, err := getUserFolders(aospVer)
 	if err != nil {
-		logger.Error("mount_dir_fusing", nil, err)
+		fusingLog.WithError(err).Error("mount_dir_fusing")
 		return err
 	}
+	logger.AddPersonalFolders(rlinuxList...)
+	logger.AddPersonalFolders(randroidList...)
 
 	err = syscall.Setreuid(0, 0)
 	if err != nil {
-		logger.Error("mount_setreuid_error", nil, err)
+		fusingLog.WithError(err).Error("mount_setreuid_error")
 		return err
 	}
 	passThroughChan := make(chan struct{})
 	passThroughTimeoutChan := make(chan struct{})
 	go func() {
-		ticker := time.NewTicker(time.Second * 100)
+		ticker := time.NewTicker(config.Get().Personal.PassThroughTimeout)
 		defer ticker.Stop()
 		for {
 			select {
 			case <-ticker.C:
-				logger.Info("received ticker timeout", "not mounted")
+				fusingLog.Info("query_pass_through_ticker_timeout")
 				passThroughTimeoutChan <- struct{}{}
 				return
 			default:
@@ -313,7 +339,7 @@ func MountPtfs(aospVer string) error {
 	case <-passThroughChan:
 	case <-passThroughTimeoutChan:
 		{
-			logger.Info("query_pass_through_tiemout_container", "not mounted")
+			fusingLog.Info("query_pass_through_tiemout_container")
 			return errors.New("timeout")
 		}
 	}
@@ -324,7 +350,7 @@ func MountPtfs(aospVer string) error {
 		for {
 			for _, dir := range randroidList {
 				if _, err := os.Stat(dir); os.IsNotExist(err) {
-					logger.Info("query_dir_exist_not", dir)
+					fusingLog.Info("query_dir_exist_not", "path", dir)
 					allExist = false
 				} else {
 					allExist = true
@@ -350,10 +376,10 @@ func MountPtfs(aospVer string) error {
 
 	mounted, _, err := getPtfs(len(randroidList))
 	if err != nil {
-		logger.Error("get_ptfs_error", nil, err)
+		fusingLog.WithError(err).Error("get_ptfs_error")
 		return err
 	}
-	logger.Info("after_get_ptfs_mounted", nil)
+	fusingLog.Info("after_get_ptfs_mounted", "mounted", mounted)
 	if mounted {
 		return nil
 	} else {
@@ -363,20 +389,42 @@ func MountPtfs(aospVer string) error {
 	defer cancel()
 
 	go inotify.WatchDir(ctx, applicationsDir, inotify.ApplicationNotifyType, inotify.DesktopFileType)
+	//files written on the linux side bypass the android fuse, let the media scanner know about them
+	for i := range rlinuxList {
+		go func(linuxDir, androidDir string) {
+			if err := inotify.WatchMediaScan(ctx, linuxDir, androidDir); err != nil {
+				fusingLog.WithError(err).Error("watch_media_scan", "path", linuxDir)
+			}
+		}(rlinuxList[i], filepath.Join(inotify.AndroidExternalStorage, androidDirList[i]))
+	}
 
 	for i, _ := range randroidList {
+		target := randroidList[i]
+		mount, ok := mounts.Add(target, func() {
+			if err := syscall.Unmount(target, 0); err != nil {
+				fusingLog.WithError(logger.Wrap("unmount", target, err)).Error("umount_volumes", "path", target)
+			}
+		})
+		if !ok {
+			//shutting down
+			wg.Done()
+			continue
+		}
 		go func(source, target string) {
+			log := fusingLog.Op("mount").With("source", source, "target", target)
 			defer func() {
 				if r := recover(); r != nil {
-					logger.Error("goroutine_panic_recovered", r, nil)
+					log.Error("goroutine_panic_recovered", "panic", r)
 				}
 			}()
 			defer wg.Done()
+			//fde_ptfs exits once the in-flight operations are over
+			defer mount.Done()
 
-			logger.Info("mount_ptfs", source+target)
+			log.Info("mount_ptfs")
 			err := mountFdePtfs(source, target)
 			if err != nil {
-				logger.Error("mount_ptfsfuse_error", err, nil)
+				log.WithError(err).Error("mount_ptfsfuse_error")
 				waitingCh <- struct{}{}
 			}
 		}(rlinuxList[i], randroidList[i])
@@ -387,6 +435,6 @@ func MountPtfs(aospVer string) error {
 		waitingCh <- struct{}{} //unlock the main goroutine
 	}()
 	<-waitingCh //block here
-	logger.Info("mount_ptfs_exit", "exit")
+	fusingLog.Info("mount_ptfs_exit")
 	return nil
 }
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/winfsp/cgofuse/fuse"
+)
+
+// quotaUsageName names the file keeping the usage of the data directory
+// between the mounts.
+const quotaUsageName = "data_usage.json"
+
+// quotaSaveInterval is how often the usage is saved while it changes.
+var quotaSaveInterval = 30 * time.Second
+
+// dataQuota is the storage android may use in the data directory: the bytes
+// of its regular files, scanned once mounted and then accounted by the
+// operations changing them. Until the scan ends the usage saved by the
+// previous mount is enforced.
+type dataQuota struct {
+	limit int64
+	file  string
+
+	mu   sync.Mutex
+	used int64
+	//the files whose size is being changed, by inode
+	inodes map[uint64]*inodeLock
+	//the changes accounted while the scan runs, added to its result
+	scanning bool
+	pending  int64
+	saved    int64
+	stop     chan struct{}
+}
+
+type inodeLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+type quotaUsageFile struct {
+	Used    int64
+	Updated time.Time
+}
+
+// newDataQuota returns the quota of limit bytes of the data directory root,
+// or nil without a limit.
+func newDataQuota(root string, limit uint64) *dataQuota {
+	if limit == 0 {
+		return nil
+	}
+	return &dataQuota{
+		limit: int64(min(limit, 1<<63-1)),
+		file:  dataUsageFile(root),
+		saved: -1,
+	}
+}
+
+// dataUsageFile returns where the usage of the data directory root,
+// ~/.local/share/openfdeXX/media/0, is kept: in ~/.local/share/openfdeXX
+// which the user owns, media belonging to media_rw.
+func dataUsageFile(root string) string {
+	return filepath.Join(filepath.Dir(filepath.Dir(root)), quotaUsageName)
+}
+
+// mounted starts accounting root, as its file system is served.
+func (q *dataQuota) mounted(root string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.stop != nil {
+		return
+	}
+	if saved, err := q.load(); err == nil {
+		q.used, q.saved = saved, saved
+	} else if !os.IsNotExist(err) {
+		ptfsLog.WithError(err).Warn("read_data_usage", "path", q.file)
+	}
+	q.scanning, q.pending = true, 0
+	q.stop = make(chan struct{})
+	go q.scan(root)
+	go q.saveEvery(q.stop)
+}
+
+// unmounted stops accounting and saves the usage.
+func (q *dataQuota) unmounted() {
+	q.mu.Lock()
+	if q.stop != nil {
+		close(q.stop)
+		q.stop = nil
+	}
+	q.mu.Unlock()
+	q.save()
+}
+
+func (q *dataQuota) scan(root string) {
+	start := time.Now()
+	used, err := diskUsage(root)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.scanning = false
+	if err != nil {
+		ptfsLog.WithError(err).Error("scan_data_usage", "path", root)
+		return
+	}
+	q.used = max(used+q.pending, 0)
+	ptfsLog.Info("scan_data_usage", "path", root, "used", q.used, "limit", q.limit, "elapsed", time.Since(start))
+}
+
+// diskUsage returns the bytes of the regular files under root, a file of
+// several links counted once.
+func diskUsage(root string) (int64, error) {
+	var used int64
+	linked := make(map[uint64]bool)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			//removed meanwhile or unreadable, not worth failing the scan
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		var st syscall.Stat_t
+		if syscall.Lstat(path, &st) != nil {
+			return nil
+		}
+		if st.Nlink > 1 {
+			if linked[st.Ino] {
+				return nil
+			}
+			linked[st.Ino] = true
+		}
+		used += st.Size
+		return nil
+	})
+	return used, err
+}
+
+// reserve accounts n more bytes, unless they would exceed the limit.
+func (q *dataQuota) reserve(n int64) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if n > 0 && q.used+n > q.limit {
+		return false
+	}
+	q.add(n)
+	return true
+}
+
+// account records a change of n bytes which already happened.
+func (q *dataQuota) account(n int64) {
+	if n == 0 {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.add(n)
+}
+
+// lockFile lets one operation at a time change the size of the file at path,
+// or open as fh unless it is ^uint64(0), so the size it reads is still the
+// size once it accounted its change. It returns the unlock function.
+func (q *dataQuota) lockFile(path string, fh uint64) func() {
+	var st syscall.Stat_t
+	var err error
+	if fh == ^uint64(0) {
+		err = syscall.Lstat(path, &st)
+	} else {
+		err = syscall.Fstat(int(fh), &st)
+	}
+	if err != nil {
+		//no size to change
+		return func() {}
+	}
+	q.mu.Lock()
+	l := q.inodes[st.Ino]
+	if l == nil {
+		if q.inodes == nil {
+			q.inodes = make(map[uint64]*inodeLock)
+		}
+		l = &inodeLock{}
+		q.inodes[st.Ino] = l
+	}
+	l.refs++
+	q.mu.Unlock()
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+		q.mu.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(q.inodes, st.Ino)
+		}
+		q.mu.Unlock()
+	}
+}
+
+func (q *dataQuota) add(n int64) {
+	q.used = max(q.used+n, 0)
+	if q.scanning {
+		q.pending += n
+	}
+}
+
+func (q *dataQuota) usage() (used, limit int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.used, q.limit
+}
+
+// statfs reports the limit as the capacity, and what is left of it as the
+// free space.
+func (q *dataQuota) statfs(stat *fuse.Statfs_t) {
+	if q == nil {
+		return
+	}
+	used, limit := q.usage()
+	capStatfs(stat, uint64(limit), uint64(used))
+}
+
+// capStatfs reports a capacity of at most quota bytes of which used are
+// taken. A zero quota leaves stat as it is.
+func capStatfs(stat *fuse.Statfs_t, quota, used uint64) {
+	if quota == 0 || stat.Frsize == 0 {
+		return
+	}
+	stat.Blocks = min(stat.Blocks, quota/stat.Frsize)
+	free := (quota - min(used, quota)) / stat.Frsize
+	stat.Bfree = min(stat.Bfree, free)
+	stat.Bavail = min(stat.Bavail, free)
+}
+
+func (q *dataQuota) saveEvery(stop <-chan struct{}) {
+	ticker := time.NewTicker(quotaSaveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			q.save()
+		}
+	}
+}
+
+// save writes the usage when it changed since the last save.
+func (q *dataQuota) save() {
+	q.mu.Lock()
+	used, saved := q.used, q.saved
+	q.mu.Unlock()
+	if used == saved {
+		return
+	}
+	data, err := json.Marshal(quotaUsageFile{Used: used, Updated: time.Now()})
+	if err == nil {
+		err = writeUserFile(q.file, data)
+	}
+	if err != nil {
+		ptfsLog.WithError(err).Error("write_data_usage", "path", q.file)
+		return
+	}
+	q.mu.Lock()
+	q.saved = used
+	q.mu.Unlock()
+}
+
+func (q *dataQuota) load() (int64, error) {
+	f, err := os.OpenFile(q.file, os.O_RDONLY|syscall.O_NOFOLLOW|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, 4096))
+	if err != nil {
+		return 0, err
+	}
+	var content quotaUsageFile
+	if err := json.Unmarshal(data, &content); err != nil {
+		return 0, err
+	}
+	return max(content.Used, 0), nil
+}
+
+// writeUserFile replaces path, in the home of the linux user, by a file of
+// data owned by the user. It is written with the identity of the process,
+// which the threads serving fuse share, so it neither follows nor reuses
+// what the user may have left at the temporary path.
+func writeUserFile(path string, data []byte) error {
+	tmp := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	os.Remove(tmp)
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL|syscall.O_NOFOLLOW, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil && syscall.Geteuid() == 0 {
+		err = f.Chown(LinuxUID, LinuxGID)
+	}
+	if errClose := f.Close(); err == nil {
+		err = errClose
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// sizeOf returns the size of the regular file at path, with fh open on it
+// unless it is ^uint64(0), and whether the file is the last link to its
+// data.
+func sizeOf(path string, fh uint64) (size int64, last bool, err error) {
+	var st syscall.Stat_t
+	if fh == ^uint64(0) {
+		err = syscall.Lstat(path, &st)
+	} else {
+		err = syscall.Fstat(int(fh), &st)
+	}
+	if err != nil || st.Mode&syscall.S_IFMT != syscall.S_IFREG {
+		return 0, false, err
+	}
+	return st.Size, st.Nlink <= 1, nil
+}
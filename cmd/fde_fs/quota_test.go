@@ -0,0 +1,296 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/winfsp/cgofuse/fuse"
+)
+
+func Test_capStatfs(t *testing.T) {
+	disk := fuse.Statfs_t{Bsize: 4096, Frsize: 4096, Blocks: 1000, Bfree: 600, Bavail: 550}
+	tests := []struct {
+		name  string
+		quota uint64
+		used  uint64
+		want  fuse.Statfs_t
+	}{
+		{name: "no quota", quota: 0, want: disk},
+		{name: "larger than the disk", quota: 4096 * 2000, want: disk},
+		{
+			name:  "smaller than the free space",
+			quota: 4096 * 100,
+			want:  fuse.Statfs_t{Bsize: 4096, Frsize: 4096, Blocks: 100, Bfree: 100, Bavail: 100},
+		},
+		{
+			name:  "larger than the free space",
+			quota: 4096*800 + 1,
+			want:  fuse.Statfs_t{Bsize: 4096, Frsize: 4096, Blocks: 800, Bfree: 600, Bavail: 550},
+		},
+		{
+			name:  "partly used",
+			quota: 4096 * 800,
+			used:  4096 * 500,
+			want:  fuse.Statfs_t{Bsize: 4096, Frsize: 4096, Blocks: 800, Bfree: 300, Bavail: 300},
+		},
+		{
+			name:  "used beyond the quota",
+			quota: 4096 * 800,
+			used:  4096 * 900,
+			want:  fuse.Statfs_t{Bsize: 4096, Frsize: 4096, Blocks: 800},
+		},
+	}
+	for _, tt := range tests {
+		got := disk
+		capStatfs(&got, tt.quota, tt.used)
+		if got != tt.want {
+			t.Errorf("%s: capStatfs() = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// newQuotaPtfs returns a Ptfs of a data directory holding a file /f of
+// used bytes, mounted with a quota of limit bytes once scanned.
+func newQuotaPtfs(t *testing.T, used int, limit uint64) *Ptfs {
+	t.Helper()
+	root := filepath.Join(t.TempDir(), "openfde14", "media", "0")
+	if err := os.MkdirAll(root, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "f"), make([]byte, used), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fs := &Ptfs{root: root, quota: newDataQuota(root, limit), caller: &caller{}}
+	fs.Init()
+	t.Cleanup(fs.Destroy)
+	waitScanned(t, fs.quota)
+	return fs
+}
+
+func waitScanned(t *testing.T, q *dataQuota) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		q.mu.Lock()
+		scanning := q.scanning
+		q.mu.Unlock()
+		if !scanning {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the data directory is still being scanned")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func used(q *dataQuota) int64 {
+	used, _ := q.usage()
+	return used
+}
+
+func TestPtfs_quota(t *testing.T) {
+	enospc := -int(syscall.ENOSPC)
+	fs := newQuotaPtfs(t, 600, 1000)
+	if got := used(fs.quota); got != 600 {
+		t.Fatalf("scanned usage = %d, want 600", got)
+	}
+
+	errc, fh := fs.Create("/g", syscall.O_RDWR|syscall.O_CREAT, 0644)
+	if errc != 0 {
+		t.Fatalf("Create() = %d", errc)
+	}
+	defer fs.Release("/g", fh)
+	if n := fs.Write("/g", make([]byte, 300), 0, fh); n != 300 {
+		t.Fatalf("Write() within the quota = %d", n)
+	}
+	//overwriting takes no more space
+	if n := fs.Write("/g", make([]byte, 300), 0, fh); n != 300 {
+		t.Fatalf("Write() over the data = %d", n)
+	}
+	if n := fs.Write("/g", make([]byte, 101), 300, fh); n != enospc {
+		t.Errorf("Write() beyond the quota = %d, want ENOSPC", n)
+	}
+	if errc := fs.Truncate("/g", 401, fh); errc != enospc {
+		t.Errorf("Truncate() beyond the quota = %d, want ENOSPC", errc)
+	}
+	if got := used(fs.quota); got != 900 {
+		t.Errorf("usage = %d, want 900", got)
+	}
+
+	if errc := fs.Truncate("/g", 100, ^uint64(0)); errc != 0 {
+		t.Fatalf("Truncate() = %d", errc)
+	}
+	if errc := fs.Unlink("/f"); errc != 0 {
+		t.Fatalf("Unlink() = %d", errc)
+	}
+	if got := used(fs.quota); got != 100 {
+		t.Errorf("usage after Truncate() and Unlink() = %d, want 100", got)
+	}
+
+	if err := os.WriteFile(filepath.Join(fs.root, "h"), make([]byte, 50), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fs.quota.account(50)
+	if errc := fs.Rename("/h", "/g"); errc != 0 {
+		t.Fatalf("Rename() = %d", errc)
+	}
+	if got := used(fs.quota); got != 50 {
+		t.Errorf("usage after Rename() over a file = %d, want 50", got)
+	}
+	errc, fh2 := fs.Open("/g", syscall.O_WRONLY|syscall.O_TRUNC)
+	if errc != 0 {
+		t.Fatalf("Open() = %d", errc)
+	}
+	fs.Release("/g", fh2)
+	if got := used(fs.quota); got != 0 {
+		t.Errorf("usage after Open() truncating = %d, want 0", got)
+	}
+}
+
+func TestPtfs_quotaPersisted(t *testing.T) {
+	fs := newQuotaPtfs(t, 600, 1000)
+	fs.Destroy()
+	if got, err := fs.quota.load(); err != nil || got != 600 {
+		t.Fatalf("load() = %d, %v, want the usage saved on Destroy", got, err)
+	}
+
+	//enforced from the next mount on, before the scan ends
+	next := newDataQuota(fs.root, 1000)
+	next.mounted(t.TempDir() + "/missing")
+	defer next.unmounted()
+	if next.reserve(401) {
+		t.Error("reserve() beyond the saved usage succeeded")
+	}
+	waitScanned(t, next)
+	if got := used(next); got != 600 {
+		t.Errorf("usage of a failed scan = %d, want the saved 600", got)
+	}
+}
+
+func TestDataQuota_pendingDuringScan(t *testing.T) {
+	q := newDataQuota(filepath.Join(t.TempDir(), "openfde14", "media", "0"), 1000)
+	q.scanning = true
+	q.account(100)
+	if !q.reserve(200) {
+		t.Fatal("reserve() within the quota failed")
+	}
+	q.scanning = false
+	if q.pending != 300 || q.used != 300 {
+		t.Errorf("pending, used = %d, %d, want 300, 300", q.pending, q.used)
+	}
+}
+
+func Test_newDataQuota(t *testing.T) {
+	if q := newDataQuota("/home/u/.local/share/openfde14/media/0", 0); q != nil {
+		t.Errorf("newDataQuota() without a limit = %+v, want nil", q)
+	}
+	q := newDataQuota("/home/u/.local/share/openfde14/media/0", 1<<30)
+	if q.file != "/home/u/.local/share/openfde14/data_usage.json" || q.limit != 1<<30 {
+		t.Errorf("newDataQuota() = %+v", q)
+	}
+	var stat fuse.Statfs_t
+	(*dataQuota)(nil).statfs(&stat)
+}
+
+func TestDataQuota_saveForUser(t *testing.T) {
+	share := filepath.Join(t.TempDir(), "openfde14")
+	media := filepath.Join(share, "media")
+	if err := os.MkdirAll(filepath.Join(media, "0"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	//as installed: the user owns openfde14, media is media_rw's and the
+	//user may not write to it
+	if os.Geteuid() == 0 {
+		defer func(uid, gid int) { LinuxUID, LinuxGID = uid, gid }(LinuxUID, LinuxGID)
+		LinuxUID, LinuxGID = 65534, 65534
+		for _, dir := range []string{filepath.Dir(filepath.Dir(share)), filepath.Dir(share)} {
+			if err := os.Chmod(dir, 0755); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := os.Chown(share, LinuxUID, LinuxGID); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chown(media, media_rw, media_rw); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Chmod(media, 0551); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(media, 0755)
+
+	q := newDataQuota(filepath.Join(media, "0"), 1000)
+	q.used = 600
+	q.save()
+	if q.saved != 600 {
+		t.Fatalf("saved = %d, want 600", q.saved)
+	}
+	if got, err := q.load(); err != nil || got != 600 {
+		t.Errorf("load() = %d, %v, want 600", got, err)
+	}
+	var st syscall.Stat_t
+	if err := syscall.Stat(q.file, &st); err != nil {
+		t.Fatal(err)
+	}
+	if int(st.Uid) != LinuxUID || int(st.Gid) != LinuxGID {
+		t.Errorf("usage file owned by %d:%d, want %d:%d", st.Uid, st.Gid, LinuxUID, LinuxGID)
+	}
+	if euid := syscall.Geteuid(); euid != os.Getuid() {
+		t.Errorf("euid = %d after save(), want %d", euid, os.Getuid())
+	}
+
+	//a symlink left by the user is not followed
+	target := filepath.Join(t.TempDir(), "target")
+	tmp := filepath.Join(share, "."+quotaUsageName+".tmp")
+	if err := os.Symlink(target, tmp); err != nil {
+		t.Fatal(err)
+	}
+	q.used = 700
+	q.save()
+	if _, err := os.Lstat(target); !os.IsNotExist(err) {
+		t.Errorf("save() wrote through the symlink: %v", err)
+	}
+	if got, err := q.load(); err != nil || got != 700 {
+		t.Errorf("load() = %d, %v, want 700", got, err)
+	}
+}
+
+func TestPtfs_quotaConcurrentAppends(t *testing.T) {
+	//the writes interleave even on a single cpu
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(8))
+	fs := newQuotaPtfs(t, 0, 1<<30)
+	errc, fh := fs.Create("/g", syscall.O_RDWR|syscall.O_CREAT, 0644)
+	if errc != 0 {
+		t.Fatalf("Create() = %d", errc)
+	}
+	defer fs.Release("/g", fh)
+
+	const writers, writes, chunk = 8, 200, 4 << 10
+	var end atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < writes; j++ {
+				ofst := end.Add(chunk) - chunk
+				if n := fs.Write("/g", make([]byte, chunk), ofst, fh); n != chunk {
+					t.Errorf("Write() = %d", n)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if got, want := used(fs.quota), int64(writers*writes*chunk); got != want {
+		t.Errorf("usage after concurrent appends = %d, want %d", got, want)
+	}
+}
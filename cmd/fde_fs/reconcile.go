@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"fde_fs/logger"
+	"os"
+	"syscall"
+)
+
+// detachStale lazily unmounts path when it is the mount point of a file
+// system whose server is gone, stat failing with ENOTCONN. It reports
+// whether path was stale.
+func detachStale(path string) (bool, error) {
+	_, err := os.Stat(path)
+	if !errors.Is(err, syscall.ENOTCONN) {
+		return false, nil
+	}
+	return true, logger.Wrap("unmount_detach", path, syscall.Unmount(path, syscall.MNT_DETACH))
+}
+
+// reconcileVolumes cleans the mount points under prefix before mounting:
+// those left behind by a dead fde_fs are lazily detached, and the
+// directories of the disks which are not in present are removed. It returns
+// the paths it cleaned.
+func reconcileVolumes(prefix string, present map[string]bool) []string {
+	entries, err := os.ReadDir(prefix)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			volumesLog.WithError(err).Error("reconcile_read_volumes", "path", prefix)
+		}
+		return nil
+	}
+	var cleaned []string
+	for _, entry := range entries {
+		path := prefix + entry.Name()
+		stale, err := detachStale(path)
+		if err != nil {
+			volumesLog.WithError(err).Error("reconcile_detach_failed", "path", path)
+			continue
+		}
+		if stale {
+			volumesLog.Info("reconcile_detached_stale", "path", path)
+			cleaned = append(cleaned, path)
+		}
+		if !entry.IsDir() || present[entry.Name()] {
+			continue
+		}
+		if isFuseMount(path) {
+			volumesLog.Warn("reconcile_orphan_still_mounted", "path", path)
+			continue
+		}
+		//only an empty directory is removed, whatever is mounted on it is safe
+		if err := os.Remove(path); err != nil {
+			volumesLog.WithError(err).Error("reconcile_remove_failed", "path", path)
+			continue
+		}
+		volumesLog.Info("reconcile_removed_orphan", "path", path)
+		cleaned = append(cleaned, path)
+	}
+	volumesLog.Info("reconcile_volumes", "cleaned", cleaned)
+	return cleaned
+}
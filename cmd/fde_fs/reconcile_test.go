@@ -0,0 +1,37 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func Test_reconcileVolumes(t *testing.T) {
+	prefix := t.TempDir() + "/"
+	for _, dir := range []string{"present", "gone", "busy"} {
+		if err := os.Mkdir(prefix+dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	//a directory which is not empty is not a mount point left behind
+	if err := os.WriteFile(filepath.Join(prefix, "busy", "file"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(prefix+".fde_path_key", nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cleaned := reconcileVolumes(prefix, map[string]bool{"present": true})
+	if want := []string{prefix + "gone"}; !reflect.DeepEqual(cleaned, want) {
+		t.Errorf("reconcileVolumes() = %v, want %v", cleaned, want)
+	}
+	for _, name := range []string{"present", "busy", ".fde_path_key"} {
+		if _, err := os.Stat(prefix + name); err != nil {
+			t.Errorf("reconcileVolumes() removed %s: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(prefix + "gone"); !os.IsNotExist(err) {
+		t.Errorf("reconcileVolumes() kept gone, err = %v", err)
+	}
+}
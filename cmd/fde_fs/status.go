@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"fde_fs/cmd/fde_fs/personal_fusing"
+	"fde_fs/config"
+	"fde_fs/logger"
+	"fde_fs/mountinfo"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// printStatus prints what is mounted and where the log goes, for bug
+// reports. It needs no privilege.
+func printStatus([]string) int {
+	mounts, err := mountinfo.Read()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		if !errors.Is(err, mountinfo.ErrMalformed) {
+			return exitFailure
+		}
+	}
+	var volumes []string
+	ptfs := 0
+	for _, m := range mounts {
+		if strings.HasPrefix(m.MountPoint, VolumesPathPrefix) {
+			volumes = append(volumes, m.MountPoint)
+		}
+		if m.FSType == personal_fusing.PtfsQueryName {
+			ptfs++
+		}
+	}
+	fmt.Printf("volumes: %d mounted\n", len(volumes))
+	for _, volume := range volumes {
+		fmt.Printf("  %s\n", volume)
+	}
+	if status, err := readMountStatus(VolumesPathPrefix + MountStatusName); err == nil {
+		for _, volume := range status.Volumes {
+			if volume.State == stateMounted || volume.State == stateUnmounted {
+				continue
+			}
+			fmt.Printf("  %s: %s after %d attempts: %s\n", volume.Path, volume.State, volume.Attempts, volume.Error)
+		}
+	}
+	fmt.Printf("personal folders: %d mounted\n", ptfs)
+	fmt.Printf("log level: %s\n", logger.Logger.GetLevel())
+	if logger.LumberLogger != nil {
+		fmt.Printf("log file: %s\n", logger.LumberLogger.Filename)
+	}
+	for _, err := range config.Errors() {
+		fmt.Printf("config ignored: %v\n", err)
+	}
+	return exitOK
+}
@@ -25,7 +25,7 @@ func getStatus() (string, error) {
 func setSoftmode() error {
 	data, err := os.ReadFile("/etc/os-release")
 	if err != nil {
-		logger.Error("read /etc/os-release failed", nil, err)
+		logger.Error("read_os_release_failed", "/etc/os-release", err)
 		return err
 	}
 	lines := strings.Split(string(data), "\n")
@@ -80,22 +80,19 @@ func setExeCtlOff(status string) error {
 	return nil
 }
 
-func setDensity(density int) {
-	if density < 120 || density > 640 {
-		fmt.Println("error: a reasonable density value is typically between 120 and 640.")
-		logger.Warn("error: a reasonable density value is typically between 120 and 640", nil)
-		return
-	}
+// setDensity sets the density of android, checked against the configured
+// range by the caller.
+func setDensity(density int) error {
 	cmd := exec.Command("waydroid", "shell", "wm", "density", strconv.Itoa(density))
 	output, err := cmd.CombinedOutput()
 	if err != nil {
-		logger.Error("waydroid set density failed", map[string]interface{}{
+		logger.Error("set_density_failed", map[string]interface{}{
 			"density": density,
 			"output":  string(output),
 		}, err)
 		fmt.Printf("set density failed：%v\n输出：%s\n", err, string(output))
 	} else {
-		logger.Warn("waydroid set density %d success\n", density)
+		logger.Info("set_density_success", density)
 		fmt.Printf("set density %d success\n", density)
 	}
 	if len(output) > 0 {
@@ -103,4 +100,5 @@ func setDensity(density int) {
 	}
 	// set a default dep for the setting app, setting app will use this as the middle default dpi
 	exec.Command("waydroid", "shell", "setprop", "FDE_DPI_DEFAULT", strconv.Itoa(density)).Run()
+	return err
 }
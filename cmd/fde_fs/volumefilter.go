@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fde_fs/config"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// diskByLabel names the devices by the label of their file system.
+const diskByLabel = "/dev/disk/by-label"
+
+var volumeFilter = newVolumeRules(config.Get().Volumes)
+
+// volumeProperties are what the rules of volumes.include and volumes.exclude
+// match.
+type volumeProperties struct {
+	UUID       string
+	Label      string
+	MountPoint string
+	FSType     string
+	Device     string
+}
+
+// volumeRules selects the volumes exported to android: a volume matching an
+// include rule, or any volume without include rules, unless it matches an
+// exclude rule. Those matching a read-only rule are exported read-only.
+type volumeRules struct {
+	include  []config.VolumeRule
+	exclude  []config.VolumeRule
+	readOnly []config.VolumeRule
+}
+
+func newVolumeRules(volumes config.Volumes) volumeRules {
+	return volumeRules{
+		include:  parseVolumeRules(volumes.Include),
+		exclude:  parseVolumeRules(volumes.Exclude),
+		readOnly: parseVolumeRules(volumes.ReadOnly),
+	}
+}
+
+func parseVolumeRules(rules []string) []config.VolumeRule {
+	var parsed []config.VolumeRule
+	//the configuration has been validated, an invalid rule cannot match
+	for _, rule := range rules {
+		if r, err := config.ParseVolumeRule(rule); err == nil {
+			parsed = append(parsed, r)
+		}
+	}
+	return parsed
+}
+
+// exported tells whether volume is exported, and which rule decided it
+// when it is not.
+func (rules volumeRules) exported(volume volumeProperties) (bool, string) {
+	for _, rule := range rules.exclude {
+		if matchVolumeRule(rule, volume) {
+			return false, "exclude " + rule.Kind + ":" + rule.Pattern
+		}
+	}
+	if len(rules.include) == 0 {
+		return true, ""
+	}
+	for _, rule := range rules.include {
+		if matchVolumeRule(rule, volume) {
+			return true, ""
+		}
+	}
+	return false, "no include rule"
+}
+
+// isReadOnly tells whether volume is exported read-only.
+func (rules volumeRules) isReadOnly(volume volumeProperties) bool {
+	for _, rule := range rules.readOnly {
+		if matchVolumeRule(rule, volume) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchVolumeRule(rule config.VolumeRule, volume volumeProperties) bool {
+	pattern := rule.Pattern
+	var value string
+	switch rule.Kind {
+	case "uuid":
+		//the uuids of vfat and ntfs are upper case, those of ext4 lower case
+		pattern, value = strings.ToLower(pattern), strings.ToLower(volume.UUID)
+	case "label":
+		value = volume.Label
+	case "mountpoint":
+		value = volume.MountPoint
+	case "fstype":
+		value = volume.FSType
+	case "device":
+		value = volume.Device
+	}
+	if value == "" {
+		return false
+	}
+	matched, _ := filepath.Match(pattern, value)
+	return matched
+}
+
+// readLabels maps the major:minor of the devices to the label of their file
+// system, from the links of dir.
+func readLabels(dir string) map[string]string {
+	labels := make(map[string]string)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			volumesLog.WithError(err).Error("read_labels", "path", dir)
+		}
+		return labels
+	}
+	for _, entry := range entries {
+		device, err := blockDevNum(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		labels[device] = unescapeLabel(entry.Name())
+	}
+	return labels
+}
+
+// unescapeLabel decodes the \xHH escapes udev uses in the names of
+// /dev/disk/by-label, e.g. "My\x20Disk".
+func unescapeLabel(name string) string {
+	var label strings.Builder
+	for i := 0; i < len(name); i++ {
+		if name[i] == '\\' && i+3 < len(name) && name[i+1] == 'x' {
+			if b, err := strconv.ParseUint(name[i+2:i+4], 16, 8); err == nil {
+				label.WriteByte(byte(b))
+				i += 3
+				continue
+			}
+		}
+		label.WriteByte(name[i])
+	}
+	return label.String()
+}
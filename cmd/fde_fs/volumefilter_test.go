@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fde_fs/config"
+	"testing"
+)
+
+func Test_volumeRules(t *testing.T) {
+	data := volumeProperties{UUID: "a1b2", Label: "Data", MountPoint: "/data", FSType: "ext4", Device: "/dev/sda5"}
+	boot := volumeProperties{UUID: "c3d4", MountPoint: "/boot", FSType: "ext4", Device: "/dev/sda1"}
+	recovery := volumeProperties{UUID: "e5f6", Label: "Recovery", MountPoint: "/media/r", FSType: "ext4", Device: "/dev/sdb1"}
+	tests := []struct {
+		name    string
+		volumes config.Volumes
+		volume  volumeProperties
+		want    bool
+	}{
+		{name: "default data", volumes: config.Default().Volumes, volume: data, want: true},
+		{name: "default boot", volumes: config.Default().Volumes, volume: boot, want: false},
+		{name: "default recovery label", volumes: config.Default().Volumes, volume: recovery, want: false},
+		{name: "no rules", volume: boot, want: true},
+		{name: "include uuid case", volumes: config.Volumes{Include: []string{"uuid:A1B2"}}, volume: data, want: true},
+		{name: "not included", volumes: config.Volumes{Include: []string{"uuid:A1B2"}}, volume: recovery, want: false},
+		{name: "exclude wins", volumes: config.Volumes{Include: []string{"fstype:ext4"}, Exclude: []string{"device:/dev/sda*"}}, volume: data, want: false},
+		{name: "no label", volumes: config.Volumes{Exclude: []string{"label:*"}}, volume: boot, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, rule := newVolumeRules(tt.volumes).exported(tt.volume); got != tt.want {
+				t.Errorf("exported() = %v (%s), want %v", got, rule, tt.want)
+			}
+		})
+	}
+}
+
+func Test_unescapeLabel(t *testing.T) {
+	tests := map[string]string{
+		`My\x20Disk`: "My Disk",
+		`a\x2fb`:     "a/b",
+		`plain`:      "plain",
+		`bad\xZZ`:    `bad\xZZ`,
+		`end\x2`:     `end\x2`,
+	}
+	for name, want := range tests {
+		if got := unescapeLabel(name); got != want {
+			t.Errorf("unescapeLabel(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -2,7 +2,10 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"fde_fs/config"
 	"fde_fs/logger"
+	"fde_fs/mountinfo"
 	"io/fs"
 	"io/ioutil"
 	"os"
@@ -13,7 +16,10 @@ import (
 )
 
 const FSPrefix = "volumes"
-const VolumesPathPrefix = "/var/lib/fde/volumes/"
+
+var VolumesPathPrefix = config.Get().Volumes.PathPrefix
+
+var volumesLog = logger.Component("volumes")
 
 type uuidToPath struct {
 	UUID string
@@ -22,23 +28,41 @@ type uuidToPath struct {
 
 func ConstructMountArgs() (mArgs []MountArgs, err error) {
 	syscall.Umask(0)
-	mounts, err := os.ReadFile("/proc/self/mountinfo")
-	if err != nil {
-		logger.Error("mount_read_mountinfo", mounts, err)
+	mounts, err := mountinfo.Read()
+	if errors.Is(err, mountinfo.ErrMalformed) {
+		//the lines we cannot parse are not volumes of ours
+		volumesLog.WithError(err).Warn("mount_read_mountinfo")
+	} else if err != nil {
+		volumesLog.WithError(err).Error("mount_read_mountinfo")
 		return
 	}
 	mountInfoByDevice := readDevicesAndMountPoint(mounts)
-	files, err := ioutil.ReadDir("/dev/disk/by-uuid")
+	files, err := ioutil.ReadDir(diskByUUID)
 	if err != nil {
-		logger.Error("mount_read_disk", mounts, err)
+		volumesLog.WithError(err).Error("mount_read_disk", "path", diskByUUID)
 		return
 	}
-	logger.Info("mount_info_by_device", mountInfoByDevice)
+	volumesLog.Info("mount_info_by_device", "devices", mountInfoByDevice)
 	volumes, err := supplementVolume(files, mountInfoByDevice)
 	if err != nil {
-		logger.Error("mount_supplement_volume", mounts, err)
+		volumesLog.WithError(err).Error("mount_supplement_volume")
 		return
 	}
+	if config.Get().Volumes.Network {
+		for id, share := range readNetworkMounts(mounts) {
+			if exported, rule := volumeFilter.exported(share.properties()); !exported {
+				volumesLog.Info("volume_excluded", "volume", share.properties(), "rule", rule)
+				continue
+			}
+			volumes[id] = share
+		}
+	}
+
+	present := make(map[string]bool, len(volumes))
+	for _, mountInfo := range volumes {
+		present[mountInfo.VolumeUUID] = true
+	}
+	reconcileVolumes(VolumesPathPrefix, present)
 
 	//register the volumes info into fde_ctrl
 
@@ -47,12 +71,12 @@ func ConstructMountArgs() (mArgs []MountArgs, err error) {
 		if os.IsNotExist(err) {
 			err = os.Mkdir(VolumesPathPrefix, os.ModeDir+0755)
 			if err != nil {
-				logger.Error("mount_mkdir_for_volumes", VolumesPathPrefix, err)
+				volumesLog.WithError(err).Error("mount_mkdir_for_volumes", "path", VolumesPathPrefix)
 				return
 			}
 		}
 	}
-	logger.Info("in_mount", volumes)
+	volumesLog.Info("in_mount", "volumes", volumes)
 	var uuidToPaths []uuidToPath
 	for _, mountInfo := range volumes {
 		path := VolumesPathPrefix + mountInfo.VolumeUUID
@@ -65,30 +89,41 @@ func ConstructMountArgs() (mArgs []MountArgs, err error) {
 			if os.IsNotExist(err) {
 				err = os.Mkdir(path, os.ModeDir+0755)
 				if err != nil {
-					logger.Error("mount_mkdir_for_volumes", mountInfo, err)
+					volumesLog.WithError(err).Error("mount_mkdir_for_volumes", "path", path, "volume", mountInfo)
 					return
 				}
 			} else {
-				logger.Error("mount_stat_volume", path, err)
-				err = syscall.Unmount(path, 0)
+				volumesLog.WithError(err).Error("mount_stat_volume", "path", path)
+				err = logger.Wrap("unmount", path, syscall.Unmount(path, 0))
 				if err != nil {
-					logger.Error("umount_volumes", path, err)
+					volumesLog.WithError(err).Error("umount_volumes", "path", path)
 					return
 				}
 			}
 		}
 
+		args := []string{"-o", "allow_other"}
+		readOnly := volumeFilter.isReadOnly(mountInfo.properties())
+		if readOnly {
+			volumesLog.Info("mount_read_only", "path", path, "volume", mountInfo.properties())
+			args = append(args, "-o", "ro")
+		}
+		fs := Ptfs{
+			root:     mountInfo.MountPoint,
+			readOnly: readOnly,
+		}
+		if mountInfo.Network {
+			fs.netTimeout = config.Get().Volumes.NetworkTimeout
+		}
 		mArgs = append(mArgs, MountArgs{
-			Args: []string{"-o", "allow_other", VolumesPathPrefix + mountInfo.VolumeUUID},
-			PassFS: Ptfs{
-				root: mountInfo.MountPoint,
-			},
+			Args:   append(args, VolumesPathPrefix+mountInfo.VolumeUUID),
+			PassFS: fs,
 		})
 	}
 	if len(uuidToPaths) > 0 {
 		err := WriteJSONToFile(VolumesPathPrefix+".fde_path_key", uuidToPaths)
 		if err != nil {
-			logger.Error("write_fde_path", uuidToPaths, err)
+			volumesLog.WithError(err).Error("write_fde_path", "volumes", uuidToPaths)
 		}
 	}
 	return
@@ -98,95 +133,96 @@ type volumeAndMountPoint struct {
 	VolumeUUID string
 	MountPoint string
 	MountID    string
-	// MountType  string
+	MountType  string
+	Label      string
+	Device     string
+	//a network share, Device being its source
+	Network bool
+}
+
+// properties returns what the volume rules match.
+func (v volumeAndMountPoint) properties() volumeProperties {
+	return volumeProperties{
+		UUID:       v.VolumeUUID,
+		Label:      v.Label,
+		MountPoint: v.MountPoint,
+		FSType:     v.MountType,
+		Device:     v.Device,
+	}
 }
 
-const LenFieldOfSelfMountInfo = 9
-const indexDevice = 9
-const indexFileType = 8
-const indexPath = 3
-const indexMountPoint = 4
-const indexMountID = 0
+// exportedFSTypes are the file systems of the volumes exported to android.
+var exportedFSTypes = map[string]bool{
+	"ext4":  true,
+	"btrfs": true,
+}
 
-func readDevicesAndMountPoint(mounts []byte) map[string]volumeAndMountPoint {
+// readDevicesAndMountPoint returns the mount point of each device, keyed by
+// its major:minor.
+func readDevicesAndMountPoint(mounts []mountinfo.Mount) map[string]volumeAndMountPoint {
 	var mountInfoByDevice map[string]volumeAndMountPoint
 	mountInfoByDevice = make(map[string]volumeAndMountPoint)
-	lines := strings.Split(string(mounts), "\n")
 	var rootMountPointFlg = false
-	for _, line := range lines {
-		fields := strings.Fields(line)
+	for _, m := range mounts {
 		//below is a line example of the mountinfo
 		//35 29 8:5 / /data rw,relatime shared:7 - ext4 /dev/sda5 rw
 		//807 790 7:1 / /var/lib/waydroid/rootfs/vendor ro,relatime shared:446 - ext4 /dev/loop1 ro
 		//29 1 252:0 / / rw,relatime shared:1 - ext4 /dev/mapper/vg-root rw
-		if len(fields) < LenFieldOfSelfMountInfo {
+		//31 1 0:27 /@ / rw,relatime shared:1 - btrfs /dev/nvme0n1p2 rw,subvol=/@
+		//continue if the filesystem is not exported
+		if !exportedFSTypes[m.FSType] {
 			continue
 		}
-		//continue if the third element is great than one char
-		if len(fields[indexPath]) > 1 {
-			continue
-		}
-		//continue if the filesystem is not ext4
-		if fields[indexFileType] != "ext4" {
+		//continue if the root of the mount is not the one of the file
+		//system, except for the subvolumes of btrfs
+		if m.Root != "/" && m.FSType != "btrfs" {
 			continue
 		}
 		//continue if the device is a loop device
-		if strings.Contains(fields[indexDevice], "loop") {
+		if strings.Contains(m.Source, "loop") {
 			continue
 		}
-		mountPoint := fields[indexMountPoint]
+		mountPoint := m.MountPoint
 		if mountPoint == "/" {
 			rootMountPointFlg = true
 		}
-		mountID := fields[indexMountID]
-		//whether a device is lvm
-		if strings.Contains(fields[indexDevice], "/dev/mapper") {
-			name, err := os.Readlink(fields[indexDevice])
-			if err != nil {
-				logger.Error("read_volumes_for_lvm", name, err)
-				return nil
-			}
-			name = strings.Replace(name, "..", "/dev", 1)
-			fields[indexDevice] = name
-		}
-		if value, exist := mountInfoByDevice[fields[indexDevice]]; exist {
+		mountID := m.ID
+		device := m.DevNum()
+		if value, exist := mountInfoByDevice[device]; exist {
 			srcMountID, err := strconv.Atoi(value.MountID)
 			if err != nil {
 				continue
 			}
-			currentMountID, err := strconv.Atoi(fields[0])
-			if err != nil {
-				continue
-			}
-			if currentMountID > srcMountID {
+			if m.ID > srcMountID {
 				mountPoint = value.MountPoint
-				mountID = value.MountID
+				mountID = srcMountID
 			}
 		}
-		mountInfoByDevice[fields[indexDevice]] = volumeAndMountPoint{
+		mountInfoByDevice[device] = volumeAndMountPoint{
 			MountPoint: mountPoint,
-			MountID:    mountID,
+			MountID:    strconv.Itoa(mountID),
+			MountType:  m.FSType,
+			Device:     m.Source,
 		}
 	}
 	if !rootMountPointFlg {
-		data, err := os.ReadFile("/proc/self/mounts")
-		if err != nil {
-			logger.Error("read_proc_mount_for_root_failed", nil, err)
-			return mountInfoByDevice
-		}
-		lines := strings.Split(string(data), "\n")
-		for _, line := range lines {
-			fields := strings.Fields(line)
-			if len(fields) < 2 {
+		//the root file system is exported whatever it is
+		for _, m := range mounts {
+			if m.MountPoint != "/" {
 				continue
 			}
-			if fields[1] == "/" {
-				mountInfoByDevice[fields[0]] = volumeAndMountPoint{
-					MountPoint: "/",
-					MountID:    "0",
-				}
+			device, err := blockDevNum(m.Source)
+			if err != nil {
+				volumesLog.WithError(err).Error("resolve_root_device", "device", m.Source)
 				break
 			}
+			mountInfoByDevice[device] = volumeAndMountPoint{
+				MountPoint: "/",
+				MountID:    "0",
+				MountType:  m.FSType,
+				Device:     m.Source,
+			}
+			break
 		}
 	}
 	return mountInfoByDevice
@@ -211,28 +247,59 @@ func WriteJSONToFile(filename string, data interface{}) error {
 	return nil
 }
 
+// supplementVolume returns the mounted volumes of /dev/disk/by-uuid, keyed
+// like mountInfoByDevice. A device which cannot be resolved is skipped.
 func supplementVolume(files []fs.FileInfo, mountInfoByDevice map[string]volumeAndMountPoint) (map[string]volumeAndMountPoint, error) {
 	var volumesByDevice map[string]volumeAndMountPoint
 	volumesByDevice = make(map[string]volumeAndMountPoint)
+	labels := readLabels(diskByLabel)
+	//the block device of each mount, btrfs is mounted with an anonymous
+	//device number and found by the device it is mounted from
+	mounted := make(map[string]string, len(mountInfoByDevice))
+	for device, value := range mountInfoByDevice {
+		if !isAnonymousDevNum(device) {
+			mounted[device] = device
+			continue
+		}
+		block, err := blockDevNum(value.Device)
+		if err != nil {
+			volumesLog.WithError(err).Warn("resolve_mount_device", "device", value.Device, "dev", device)
+			continue
+		}
+		mounted[block] = device
+	}
 	for _, v := range files {
-		name, err := os.Readlink(filepath.Join("/dev/disk/by-uuid/", v.Name()))
+		devices, err := uuidDevNums(v.Name())
 		if err != nil {
-			if os.IsNotExist(err) {
-				continue
+			if !os.IsNotExist(err) {
+				volumesLog.WithError(err).Error("read_volumes", "uuid", v.Name())
 			}
-			logger.Error("read_volumes", name, err)
-			if os.IsNotExist(err) {
+			continue
+		}
+		for _, block := range devices {
+			device, exist := mounted[block]
+			if !exist {
 				continue
 			}
-			return nil, err
-		}
-		name = strings.Replace(name, "../..", "/dev", 1)
-		if value, exist := mountInfoByDevice[name]; exist {
-			volumesByDevice[name] = volumeAndMountPoint{
+			value := mountInfoByDevice[device]
+			name := blockDeviceName(devices[0])
+			if name == "" {
+				name = value.Device
+			}
+			volume := volumeAndMountPoint{
 				VolumeUUID: v.Name(),
 				MountPoint: value.MountPoint,
 				MountID:    value.MountID,
+				MountType:  value.MountType,
+				Label:      labels[devices[0]],
+				Device:     name,
+			}
+			if exported, rule := volumeFilter.exported(volume.properties()); !exported {
+				volumesLog.Info("volume_excluded", "volume", volume.properties(), "rule", rule)
+				break
 			}
+			volumesByDevice[device] = volume
+			break
 		}
 	}
 	return volumesByDevice, nil
@@ -245,7 +312,7 @@ func UmountAllVolumes() error {
 	}
 	home, err := os.UserHomeDir()
 	if err != nil {
-		logger.Error("mount_query_home_failed", os.Getuid(), err)
+		volumesLog.WithError(err).Error("mount_query_home_failed", "uid", os.Getuid())
 		return err
 	}
 	openfde := filepath.Join(home, "openfde")
@@ -256,9 +323,9 @@ func UmountAllVolumes() error {
 			continue
 		}
 		path := VolumesPathPrefix + volume.Name()
-		err = syscall.Unmount(path, 0)
+		err = logger.Wrap("unmount", path, syscall.Unmount(path, 0))
 		if err != nil {
-			logger.Error("umount_volumes", path, err)
+			volumesLog.WithError(err).Error("umount_volumes", "path", path)
 			os.Remove(path)
 		}
 	}
@@ -23,17 +23,28 @@ func setuidgid() func() {
 	}
 }
 
+// stValid is ST_VALID, set by statfs in the flags it fills.
+const stValid = 0x20
+
+// copyFusestatfsFromGostatfs reports the underlying file system as it is:
+// the blocks are counted in fragments of Frsize, Bavail leaves out the
+// blocks reserved to root and Favail is Ffree as statvfs does.
 func copyFusestatfsFromGostatfs(dst *fuse.Statfs_t, src *syscall.Statfs_t) {
 	*dst = fuse.Statfs_t{}
 	dst.Bsize = uint64(src.Bsize)
-	dst.Frsize = 1
+	dst.Frsize = uint64(src.Frsize)
+	if dst.Frsize == 0 {
+		//kernels before 2.6 do not fill it
+		dst.Frsize = dst.Bsize
+	}
 	dst.Blocks = uint64(src.Blocks)
 	dst.Bfree = uint64(src.Bfree)
 	dst.Bavail = uint64(src.Bavail)
 	dst.Files = uint64(src.Files)
 	dst.Ffree = uint64(src.Ffree)
 	dst.Favail = uint64(src.Ffree)
-	dst.Namemax = 255 //uint64(src.Namelen)
+	dst.Flag = uint64(src.Flags) &^ stValid
+	dst.Namemax = uint64(src.Namelen)
 }
 
 func copyFusestatFromGostat(dst *fuse.Stat_t, src *syscall.Stat_t) {
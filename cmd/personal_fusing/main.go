@@ -16,12 +16,14 @@
 package main
 
 import (
+	"fde_fs/inotify"
 	"fde_fs/logger"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"strconv"
+	"sync"
 	"syscall"
 
 	"github.com/winfsp/cgofuse/examples/shared"
@@ -52,10 +54,14 @@ var (
 	_host *fuse.FileSystemHost
 )
 
+var ptfsLog = logger.Component("ptfs")
+
 type Ptfs struct {
 	fuse.FileSystemBase
 	ns   uint64
 	root string
+	//the handles android wrote to, marked on release for the media scan
+	written sync.Map
 }
 
 func (self *Ptfs) Init() {
@@ -83,7 +89,7 @@ func (self *Ptfs) readNS(pid string) (nsid uint64, err error) {
 	file := "/proc/" + pid + "/ns/pid"
 	fd, err := os.Open(file)
 	if err != nil {
-		logger.Error("read_name_space_fs", nil, err)
+		ptfsLog.WithError(err).Error("read_name_space_fs", "pid", pid)
 		return
 	}
 	defer fd.Close()
@@ -98,7 +104,7 @@ func (self *Ptfs) recordNameSpace() {
 	var err error
 	self.ns, err = self.readNS(strconv.Itoa(pid))
 	if err != nil {
-		logger.Error("record_ns", nil, err)
+		ptfsLog.WithError(err).Error("record_ns", "pid", pid)
 	}
 	return
 
@@ -214,7 +220,11 @@ func (self *Ptfs) Create(path string, flags int, mode uint32) (errc int, fh uint
 	syscall.Stat(self.root, &st)
 	copyFusestatFromGostat(&dstSt, &st)
 	defer syscall.Chown(filepath.Join(self.root, path), int(dstSt.Uid), int(dstSt.Gid))
-	return self.open(path, flags, mode)
+	errc, fh = self.open(path, flags, mode)
+	if errc == 0 {
+		self.written.Store(fh, true)
+	}
+	return
 }
 
 func (self *Ptfs) Open(path string, flags int) (errc int, fh uint64) {
@@ -251,6 +261,7 @@ func (self *Ptfs) Truncate(path string, size int64, fh uint64) (errc int) {
 		errc = errno(syscall.Truncate(path, size))
 	} else {
 		errc = errno(syscall.Ftruncate(int(fh), size))
+		self.written.Store(fh, true)
 	}
 	return
 }
@@ -270,11 +281,18 @@ func (self *Ptfs) Write(path string, buff []byte, ofst int64, fh uint64) (n int)
 	if nil != e {
 		return errno(e)
 	}
+	self.written.Store(fh, true)
 	return n
 }
 
 func (self *Ptfs) Release(path string, fh uint64) (errc int) {
 	defer trace(path, fh)(&errc)
+	if _, ok := self.written.LoadAndDelete(fh); ok {
+		//android indexes what it wrote, the linux watcher must not scan it again
+		if err := inotify.MarkAndroidWritten(int(fh)); err != nil {
+			ptfsLog.WithError(err).Warn("mark_android_written", "path", path)
+		}
+	}
 	return errno(syscall.Close(int(fh)))
 }
 
@@ -338,6 +356,10 @@ func main() {
 		ptfs.root, _ = filepath.Abs(args[len(args)-2])
 		args = append(args[:len(args)-2], args[len(args)-1])
 	}
+	if ptfs.root != "" {
+		logger.AddPersonalFolders(ptfs.root)
+	}
+	logger.WatchLevelSignals()
 	_host = fuse.NewFileSystemHost(&ptfs)
 	_host.Mount("", args[1:])
 }
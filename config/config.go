@@ -0,0 +1,504 @@
+// Package config holds the paths and tunables of fde_fs, read from
+// SystemFile and the per-user file, with defaults matching the values
+// fde_fs always used.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// SystemFile is the configuration of the machine, only root may write it.
+var SystemFile = "/etc/fde/fde_fs.toml"
+
+// Config is the effective configuration.
+type Config struct {
+	Volumes  Volumes  `toml:"volumes"`
+	Personal Personal `toml:"personal"`
+	Display  Display  `toml:"display"`
+	Android  Android  `toml:"android"`
+	Log      Log      `toml:"log"`
+}
+
+type Volumes struct {
+	//where the volumes are mounted, one directory per volume uuid
+	PathPrefix string `toml:"path_prefix"`
+	//rules selecting the volumes exported to android, see VolumeRule
+	Include []string `toml:"include"`
+	Exclude []string `toml:"exclude"`
+	//rules selecting the exported volumes android may not write to
+	ReadOnly []string `toml:"read_only"`
+	//export the nfs, cifs and sshfs mounts too
+	Network bool `toml:"network"`
+	//how long a network volume may take to answer before EIO
+	NetworkTimeout time.Duration `toml:"network_timeout"`
+}
+
+type Personal struct {
+	//watched for .desktop files to hand over to android
+	ApplicationsDir string `toml:"applications_dir"`
+	//how long to wait for the container to allow the pass through
+	PassThroughTimeout time.Duration `toml:"pass_through_timeout"`
+}
+
+type Display struct {
+	DensityMin int `toml:"density_min"`
+	DensityMax int `toml:"density_max"`
+}
+
+type Android struct {
+	//uid of media_rw, owning the android shared storage
+	MediaRWUID  int    `toml:"media_rw_uid"`
+	VendorImage string `toml:"vendor_image"`
+	BuildProp   string `toml:"build_prop"`
+	//the most android may store in its data directory, 0 for the whole
+	//partition of the home directory
+	DataQuota Size `toml:"data_quota"`
+}
+
+type Log struct {
+	File string `toml:"file"`
+	//panic, fatal, error, warn, info, debug or trace, saved by fde_fs
+	//log-level and re-read on SIGHUP
+	Level string `toml:"level"`
+	//where the lines go: file, stderr, journald or syslog
+	Output []string `toml:"output"`
+	//when the file is rotated besides its size limit: daily, hourly or off.
+	//Every fde_fs and fde_ptfs writes the same file, off by default
+	Rotate string `toml:"rotate"`
+	//how the rotated files are compressed, e.g. "zstd" or "gzip:9", empty
+	//for gzip at its default level
+	Compression string `toml:"compression"`
+	//when the file is synced: "never", or a list of "error", a number of
+	//writes and an interval, e.g. "error,5s"
+	Sync string `toml:"sync"`
+	//hash the personal file names and hide the home directory
+	Redact bool `toml:"redact"`
+}
+
+// Default returns the configuration used without any file.
+func Default() *Config {
+	return &Config{
+		Volumes: Volumes{
+			PathPrefix: "/var/lib/fde/volumes/",
+			Exclude: []string{
+				"mountpoint:/boot",
+				"mountpoint:/boot/*",
+				"mountpoint:/efi",
+				"mountpoint:/recovery",
+				"fstype:swap",
+				"label:EFI*",
+				"label:*[Rr]ecovery*",
+				"label:System Reserved",
+			},
+			NetworkTimeout: 10 * time.Second,
+		},
+		Personal: Personal{
+			ApplicationsDir:    "/usr/share/applications",
+			PassThroughTimeout: 100 * time.Second,
+		},
+		Display: Display{
+			DensityMin: 120,
+			DensityMax: 640,
+		},
+		Android: Android{
+			MediaRWUID:  1023,
+			VendorImage: "/usr/share/waydroid-extra/images/vendor.img",
+			BuildProp:   "/var/lib/waydroid/rootfs/vendor/build.prop",
+		},
+		Log: Log{
+			File:   "/var/log/fde.log",
+			Level:  "error",
+			Output: []string{"file"},
+			Rotate: "off",
+			Sync:   "error",
+			Redact: true,
+		},
+	}
+}
+
+// userKeys are the keys a user may override. fde_fs runs as root, so the
+// paths it mounts, chowns or writes to are only taken from SystemFile.
+var userKeys = map[string]bool{
+	"personal.pass_through_timeout": true,
+	"display.density_min":           true,
+	"display.density_max":           true,
+}
+
+// UserFile returns $XDG_CONFIG_HOME/openfde/fde_fs.toml, XDG_CONFIG_HOME
+// defaulting to ~/.config.
+func UserFile() string {
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if !filepath.IsAbs(configHome) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		configHome = filepath.Join(home, ".config")
+	}
+	return filepath.Join(configHome, "openfde", "fde_fs.toml")
+}
+
+var (
+	loadOnce sync.Once
+	current  *Config
+	loadErrs []error
+)
+
+// Get returns the configuration of SystemFile and UserFile, loaded on first
+// use. A file which cannot be used is ignored, see Errors.
+func Get() *Config {
+	loadOnce.Do(func() {
+		current, loadErrs = Load(SystemFile, UserFile())
+	})
+	return current
+}
+
+// Errors returns why files were ignored by Get.
+func Errors() []error {
+	Get()
+	return loadErrs
+}
+
+// Load returns the defaults overridden by systemPath, then by userPath. A
+// missing file is skipped, an invalid one is ignored as a whole and reported.
+func Load(systemPath, userPath string) (*Config, []error) {
+	cfg := Default()
+	var errs []error
+	if systemPath != "" {
+		if err := cfg.merge(systemPath, nil, -1); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if userPath != "" {
+		if err := cfg.merge(userPath, userKeys, os.Getuid()); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return cfg, errs
+}
+
+// merge overrides cfg by the file at path if it is valid. Only the keys of
+// allowed are accepted when not nil, and the file must belong to owner
+// unless it is negative.
+func (cfg *Config) merge(path string, allowed map[string]bool, owner int) error {
+	data, err := readOwnedFile(path, owner)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	merged := *cfg
+	//decoding reuses the arrays of the slices, cfg must stay untouched
+	merged.Volumes.Include = append([]string(nil), cfg.Volumes.Include...)
+	merged.Volumes.Exclude = append([]string(nil), cfg.Volumes.Exclude...)
+	merged.Volumes.ReadOnly = append([]string(nil), cfg.Volumes.ReadOnly...)
+	merged.Log.Output = append([]string(nil), cfg.Log.Output...)
+	meta, err := toml.Decode(string(data), &merged)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+		return fmt.Errorf("%s: unknown key %s", path, undecoded[0])
+	}
+	if allowed != nil {
+		for _, key := range meta.Keys() {
+			if len(key) > 1 && !allowed[key.String()] {
+				return fmt.Errorf("%s: %s may only be set in %s", path, key, SystemFile)
+			}
+		}
+	}
+	if err := merged.Validate(); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	*cfg = merged
+	return nil
+}
+
+// readOwnedFile reads path, refusing anything but a regular file owned by
+// owner when owner is not negative: a setuid fde_fs must not read other
+// files for the user and show them in its errors.
+func readOwnedFile(path string, owner int) ([]byte, error) {
+	f, err := os.OpenFile(path, os.O_RDONLY|syscall.O_NOFOLLOW|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		if errors.Is(err, syscall.ELOOP) {
+			return nil, errors.New("is a symlink")
+		}
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, errors.New("not a regular file")
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok && owner >= 0 && int(stat.Uid) != owner {
+		return nil, fmt.Errorf("owned by uid %d instead of %d", stat.Uid, owner)
+	}
+	return io.ReadAll(io.LimitReader(f, 1<<20))
+}
+
+// Validate checks the values are usable, and adds the trailing slash the
+// volumes prefix is used with.
+func (cfg *Config) Validate() error {
+	paths := map[string]*string{
+		"volumes.path_prefix":       &cfg.Volumes.PathPrefix,
+		"personal.applications_dir": &cfg.Personal.ApplicationsDir,
+		"android.vendor_image":      &cfg.Android.VendorImage,
+		"android.build_prop":        &cfg.Android.BuildProp,
+		"log.file":                  &cfg.Log.File,
+	}
+	for key, path := range paths {
+		if !filepath.IsAbs(*path) {
+			return fmt.Errorf("%s: %q is not an absolute path", key, *path)
+		}
+		*path = filepath.Clean(*path)
+	}
+	if cfg.Volumes.PathPrefix == "/" {
+		return fmt.Errorf("volumes.path_prefix: / is not allowed")
+	}
+	if !strings.HasSuffix(cfg.Volumes.PathPrefix, "/") {
+		cfg.Volumes.PathPrefix += "/"
+	}
+	for _, rules := range [][]string{cfg.Volumes.Include, cfg.Volumes.Exclude, cfg.Volumes.ReadOnly} {
+		for _, rule := range rules {
+			if _, err := ParseVolumeRule(rule); err != nil {
+				return err
+			}
+		}
+	}
+	if cfg.Volumes.NetworkTimeout <= 0 {
+		return fmt.Errorf("volumes.network_timeout: %v is not positive", cfg.Volumes.NetworkTimeout)
+	}
+	if cfg.Personal.PassThroughTimeout <= 0 {
+		return fmt.Errorf("personal.pass_through_timeout: %v is not positive", cfg.Personal.PassThroughTimeout)
+	}
+	if cfg.Display.DensityMin <= 0 || cfg.Display.DensityMin > cfg.Display.DensityMax {
+		return fmt.Errorf("display: invalid density range %d-%d", cfg.Display.DensityMin, cfg.Display.DensityMax)
+	}
+	if cfg.Android.MediaRWUID < 0 {
+		return fmt.Errorf("android.media_rw_uid: %d is negative", cfg.Android.MediaRWUID)
+	}
+	if !logLevels[strings.ToLower(cfg.Log.Level)] {
+		return fmt.Errorf("log.level: invalid level %q", cfg.Log.Level)
+	}
+	for _, output := range cfg.Log.Output {
+		if !logOutputs[output] {
+			return fmt.Errorf("log.output: invalid output %q, want file, stderr, journald or syslog", output)
+		}
+	}
+	if !logRotations[cfg.Log.Rotate] {
+		return fmt.Errorf("log.rotate: invalid rotation %q, want daily, hourly or off", cfg.Log.Rotate)
+	}
+	if !validLogCompression(cfg.Log.Compression) {
+		return fmt.Errorf("log.compression: invalid compression %q, want none, gzip, gzip:1-9, zstd or zstd:1-4", cfg.Log.Compression)
+	}
+	if !validLogSync(cfg.Log.Sync) {
+		return fmt.Errorf("log.sync: invalid policy %q, want never or a list of error, a number of writes and an interval", cfg.Log.Sync)
+	}
+	return nil
+}
+
+var (
+	logLevels = map[string]bool{
+		"panic": true, "fatal": true, "error": true, "warn": true,
+		"warning": true, "info": true, "debug": true, "trace": true,
+	}
+	logOutputs   = map[string]bool{"file": true, "stderr": true, "journald": true, "syslog": true}
+	logRotations = map[string]bool{"daily": true, "hourly": true, "off": true}
+	//the compression levels of lumberjack, gzip's and zstd's
+	logCompressionLevels = map[string][2]int{"gzip": {1, 9}, "zstd": {1, 4}}
+)
+
+// validLogCompression tells whether lumberjack knows compression, empty
+// meaning gzip at its default level.
+func validLogCompression(compression string) bool {
+	name, level, hasLevel := strings.Cut(strings.ToLower(strings.TrimSpace(compression)), ":")
+	if name == "" || name == "none" || name == "off" {
+		return !hasLevel
+	}
+	levels, ok := logCompressionLevels[name]
+	if !ok || !hasLevel {
+		return ok
+	}
+	n, err := strconv.Atoi(level)
+	return err == nil && n >= levels[0] && n <= levels[1]
+}
+
+// validLogSync tells whether the logger knows the sync policy: "never", or
+// a comma separated list of "error", a number of writes and an interval.
+func validLogSync(policy string) bool {
+	for _, item := range strings.Split(policy, ",") {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if item == "" || item == "never" || item == "error" {
+			continue
+		}
+		if n, err := strconv.Atoi(item); err == nil && n > 0 {
+			continue
+		}
+		if d, err := time.ParseDuration(item); err == nil && d > 0 {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+// SetValue sets key of table in the file at path to the string value,
+// creating the file or the table if needed. The other lines, comments
+// included, are kept as they are.
+func SetValue(path, table, key, value string) error {
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	line := key + " = " + strconv.Quote(value)
+	var lines []string
+	if len(data) > 0 {
+		lines = strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	}
+	//the table spans from its header to the next one
+	var updated []string
+	found, inTable, replaced := false, false, false
+	for _, l := range lines {
+		trimmed := strings.TrimSpace(l)
+		if strings.HasPrefix(trimmed, "[") {
+			if inTable && !replaced {
+				updated, replaced = insertLine(updated, line), true
+			}
+			name, _, _ := strings.Cut(trimmed, "#")
+			inTable = strings.TrimSpace(name) == "["+table+"]"
+			found = found || inTable
+		} else if inTable && !strings.HasPrefix(trimmed, "#") {
+			if k, _, ok := strings.Cut(l, "="); ok && strings.TrimSpace(k) == key {
+				if replaced {
+					continue
+				}
+				l, replaced = line, true
+			}
+		}
+		updated = append(updated, l)
+	}
+	switch {
+	case !found:
+		if len(updated) > 0 {
+			updated = append(updated, "")
+		}
+		updated = append(updated, "["+table+"]", line)
+	case !replaced:
+		updated = insertLine(updated, line)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(strings.Join(updated, "\n")+"\n"), 0644)
+}
+
+// insertLine appends line to lines, before the blank lines ending them.
+func insertLine(lines []string, line string) []string {
+	n := len(lines)
+	for n > 0 && strings.TrimSpace(lines[n-1]) == "" {
+		n--
+	}
+	return append(lines[:n], append([]string{line}, lines[n:]...)...)
+}
+
+// VolumeRule selects volumes by one of their properties, written
+// "kind:pattern". The kinds are uuid, label, mountpoint, fstype and device,
+// the pattern being a glob as understood by filepath.Match, e.g.
+// "mountpoint:/boot/*" or "device:/dev/sdb*".
+type VolumeRule struct {
+	Kind    string
+	Pattern string
+}
+
+var volumeRuleKinds = map[string]bool{
+	"uuid":       true,
+	"label":      true,
+	"mountpoint": true,
+	"fstype":     true,
+	"device":     true,
+}
+
+// ParseVolumeRule parses a rule of volumes.include, volumes.exclude or
+// volumes.read_only.
+func ParseVolumeRule(rule string) (VolumeRule, error) {
+	kind, pattern, ok := strings.Cut(rule, ":")
+	if !ok || !volumeRuleKinds[kind] || pattern == "" {
+		return VolumeRule{}, fmt.Errorf("volumes: invalid rule %q, want uuid, label, mountpoint, fstype or device:pattern", rule)
+	}
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return VolumeRule{}, fmt.Errorf("volumes: invalid rule %q: %v", rule, err)
+	}
+	return VolumeRule{Kind: kind, Pattern: pattern}, nil
+}
+
+// Size is a number of bytes, written with an optional K, M, G or T suffix
+// of powers of 1024, e.g. "20G".
+type Size uint64
+
+var sizeUnits = []struct {
+	suffix string
+	shift  uint
+}{
+	{"T", 40},
+	{"G", 30},
+	{"M", 20},
+	{"K", 10},
+}
+
+// ParseSize parses a Size.
+func ParseSize(s string) (Size, error) {
+	shift := uint(0)
+	number := strings.TrimSuffix(strings.TrimSpace(s), "B")
+	for _, unit := range sizeUnits {
+		if trimmed, ok := strings.CutSuffix(number, unit.suffix); ok {
+			number, shift = trimmed, unit.shift
+			break
+		}
+	}
+	n, err := strconv.ParseUint(number, 10, 64)
+	if err != nil || n > math.MaxUint64>>shift {
+		return 0, fmt.Errorf("invalid size %q, want bytes or a number followed by K, M, G or T", s)
+	}
+	return Size(n << shift), nil
+}
+
+func (size *Size) UnmarshalText(text []byte) error {
+	parsed, err := ParseSize(string(text))
+	if err != nil {
+		return err
+	}
+	*size = parsed
+	return nil
+}
+
+func (size Size) MarshalText() ([]byte, error) {
+	for _, unit := range sizeUnits {
+		if size != 0 && size%(1<<unit.shift) == 0 {
+			return []byte(strconv.FormatUint(uint64(size>>unit.shift), 10) + unit.suffix), nil
+		}
+	}
+	return []byte(strconv.FormatUint(uint64(size), 10)), nil
+}
+
+// Print writes cfg as TOML.
+func (cfg *Config) Print(w io.Writer) error {
+	enc := toml.NewEncoder(w)
+	enc.Indent = ""
+	return enc.Encode(cfg)
+}
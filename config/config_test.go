@@ -0,0 +1,358 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "fde_fs.toml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDefaultIsValid(t *testing.T) {
+	cfg := Default()
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cfg, Default()) {
+		t.Errorf("Validate() changed the defaults: %+v", cfg)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		system  string
+		user    string
+		want    func(*Config)
+		wantErr string
+	}{
+		{
+			name: "no files",
+			want: func(*Config) {},
+		},
+		{
+			name:   "system overrides",
+			system: "[volumes]\npath_prefix = \"/media/fde\"\n[personal]\npass_through_timeout = \"30s\"\n",
+			want: func(cfg *Config) {
+				cfg.Volumes.PathPrefix = "/media/fde/"
+				cfg.Personal.PassThroughTimeout = 30 * time.Second
+			},
+		},
+		{
+			name: "user overrides",
+			user: "[display]\ndensity_min = 160\n",
+			want: func(cfg *Config) { cfg.Display.DensityMin = 160 },
+		},
+		{
+			name:    "user may not set paths",
+			system:  "[display]\ndensity_max = 480\n",
+			user:    "[display]\ndensity_min = 160\n[android]\nvendor_image = \"/tmp/vendor.img\"\n",
+			want:    func(cfg *Config) { cfg.Display.DensityMax = 480 },
+			wantErr: "android.vendor_image may only be set in",
+		},
+		{
+			name:    "unknown key",
+			system:  "[volumes]\nprefix = \"/media\"\n",
+			want:    func(*Config) {},
+			wantErr: "unknown key volumes.prefix",
+		},
+		{
+			name:    "invalid range",
+			system:  "[display]\ndensity_min = 700\n",
+			want:    func(*Config) {},
+			wantErr: "invalid density range",
+		},
+		{
+			name:    "relative path",
+			system:  "[log]\nfile = \"fde.log\"\n",
+			want:    func(*Config) {},
+			wantErr: "not an absolute path",
+		},
+		{
+			name:   "volume rules",
+			system: "[volumes]\ninclude = [\"label:Data*\"]\nexclude = []\nread_only = [\"fstype:nfs*\"]\n",
+			want: func(cfg *Config) {
+				cfg.Volumes.Include = []string{"label:Data*"}
+				cfg.Volumes.Exclude = []string{}
+				cfg.Volumes.ReadOnly = []string{"fstype:nfs*"}
+			},
+		},
+		{
+			name:   "network volumes",
+			system: "[volumes]\nnetwork = true\nnetwork_timeout = \"5s\"\n",
+			want: func(cfg *Config) {
+				cfg.Volumes.Network = true
+				cfg.Volumes.NetworkTimeout = 5 * time.Second
+			},
+		},
+		{
+			name:    "invalid network timeout",
+			system:  "[volumes]\nnetwork_timeout = \"-1s\"\n",
+			want:    func(*Config) {},
+			wantErr: "network_timeout",
+		},
+		{
+			name:   "data quota",
+			system: "[android]\ndata_quota = \"20G\"\n",
+			want:   func(cfg *Config) { cfg.Android.DataQuota = 20 << 30 },
+		},
+		{
+			name:   "data quota in bytes",
+			system: "[android]\ndata_quota = 1048576\n",
+			want:   func(cfg *Config) { cfg.Android.DataQuota = 1 << 20 },
+		},
+		{
+			name:    "invalid data quota",
+			system:  "[android]\ndata_quota = \"20 gigs\"\n",
+			want:    func(*Config) {},
+			wantErr: "invalid size",
+		},
+		{
+			name:    "user may not set volume rules",
+			user:    "[volumes]\nexclude = []\n",
+			want:    func(*Config) {},
+			wantErr: "volumes.exclude may only be set in",
+		},
+		{
+			name:    "invalid volume rule",
+			system:  "[volumes]\nexclude = [\"size:10G\"]\n",
+			want:    func(*Config) {},
+			wantErr: "invalid rule",
+		},
+		{
+			name:   "log settings",
+			system: "[log]\nlevel = \"debug\"\noutput = [\"journald\", \"file\"]\nrotate = \"daily\"\ncompression = \"zstd\"\nredact = false\n",
+			want: func(cfg *Config) {
+				cfg.Log.Level = "debug"
+				cfg.Log.Output = []string{"journald", "file"}
+				cfg.Log.Rotate = "daily"
+				cfg.Log.Compression = "zstd"
+				cfg.Log.Redact = false
+			},
+		},
+		{
+			name:    "user may not set log settings",
+			user:    "[log]\nlevel = \"trace\"\n",
+			want:    func(*Config) {},
+			wantErr: "log.level may only be set in",
+		},
+		{
+			name:    "invalid log level",
+			system:  "[log]\nlevel = \"loud\"\n",
+			want:    func(*Config) {},
+			wantErr: "log.level",
+		},
+		{
+			name:    "invalid log output",
+			system:  "[log]\noutput = [\"file\", \"printer\"]\n",
+			want:    func(*Config) {},
+			wantErr: "log.output",
+		},
+		{
+			name:   "log compression and sync",
+			system: "[log]\ncompression = \"gzip:9\"\nsync = \"error, 100, 5s\"\n",
+			want: func(cfg *Config) {
+				cfg.Log.Compression = "gzip:9"
+				cfg.Log.Sync = "error, 100, 5s"
+			},
+		},
+		{
+			name:    "invalid log compression",
+			system:  "[log]\ncompression = \"zip\"\n",
+			want:    func(*Config) {},
+			wantErr: "log.compression",
+		},
+		{
+			name:    "invalid log compression level",
+			system:  "[log]\ncompression = \"zstd:9\"\n",
+			want:    func(*Config) {},
+			wantErr: "log.compression",
+		},
+		{
+			name:    "invalid log sync",
+			system:  "[log]\nsync = \"erorr\"\n",
+			want:    func(*Config) {},
+			wantErr: "log.sync",
+		},
+		{
+			name:    "invalid log sync interval",
+			system:  "[log]\nsync = \"error,-5s\"\n",
+			want:    func(*Config) {},
+			wantErr: "log.sync",
+		},
+		{
+			name:    "syntax error",
+			system:  "[volumes\n",
+			want:    func(*Config) {},
+			wantErr: "fde_fs.toml",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			systemPath := filepath.Join(t.TempDir(), "missing.toml")
+			if tt.system != "" {
+				systemPath = writeFile(t, tt.system)
+			}
+			userPath := ""
+			if tt.user != "" {
+				userPath = writeFile(t, tt.user)
+			}
+			got, errs := Load(systemPath, userPath)
+			want := Default()
+			tt.want(want)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Load() = %+v, want %+v", got, want)
+			}
+			switch {
+			case tt.wantErr == "" && len(errs) > 0:
+				t.Errorf("Load() errors = %v", errs)
+			case tt.wantErr != "" && (len(errs) != 1 || !strings.Contains(errs[0].Error(), tt.wantErr)):
+				t.Errorf("Load() errors = %v, want %q", errs, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadRefusesSymlink(t *testing.T) {
+	target := writeFile(t, "[display]\ndensity_min = 160\n")
+	link := filepath.Join(t.TempDir(), "fde_fs.toml")
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+	got, errs := Load("", link)
+	if len(errs) != 1 || got.Display.DensityMin != Default().Display.DensityMin {
+		t.Errorf("Load() = %+v, %v, want the symlink refused", got.Display, errs)
+	}
+}
+
+func TestParseVolumeRule(t *testing.T) {
+	tests := []struct {
+		rule    string
+		want    VolumeRule
+		wantErr bool
+	}{
+		{rule: "mountpoint:/boot/*", want: VolumeRule{Kind: "mountpoint", Pattern: "/boot/*"}},
+		{rule: "label:System Reserved", want: VolumeRule{Kind: "label", Pattern: "System Reserved"}},
+		{rule: "uuid:1234-ABCD", want: VolumeRule{Kind: "uuid", Pattern: "1234-ABCD"}},
+		{rule: "/boot", wantErr: true},
+		{rule: "size:10G", wantErr: true},
+		{rule: "label:", wantErr: true},
+		{rule: "device:/dev/sd[", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseVolumeRule(tt.rule)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseVolumeRule(%q) error = %v, wantErr %v", tt.rule, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseVolumeRule(%q) = %+v, want %+v", tt.rule, got, tt.want)
+		}
+	}
+}
+
+func TestSize(t *testing.T) {
+	tests := []struct {
+		text    string
+		want    Size
+		wantErr bool
+	}{
+		{text: "0", want: 0},
+		{text: "4096", want: 4096},
+		{text: "512K", want: 512 << 10},
+		{text: "20G", want: 20 << 30},
+		{text: "2TB", want: 2 << 40},
+		{text: "1.5G", wantErr: true},
+		{text: "-1", wantErr: true},
+		{text: "G", wantErr: true},
+		{text: "17000000T", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseSize(tt.text)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseSize(%q) error = %v, wantErr %v", tt.text, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseSize(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+		if tt.wantErr {
+			continue
+		}
+		text, _ := got.MarshalText()
+		if again, err := ParseSize(string(text)); err != nil || again != got {
+			t.Errorf("ParseSize(MarshalText(%d)) = %d, %v", got, again, err)
+		}
+	}
+}
+
+func TestSetValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name: "missing file",
+			want: "[log]\nlevel = \"debug\"\n",
+		},
+		{
+			name:    "missing table",
+			content: "[volumes]\nnetwork = true\n",
+			want:    "[volumes]\nnetwork = true\n\n[log]\nlevel = \"debug\"\n",
+		},
+		{
+			name:    "rewritten in place",
+			content: "# fde\n[log]\nfile = \"/var/log/fde.log\"\nlevel=\"error\"\nsync = \"error\"\n",
+			want:    "# fde\n[log]\nfile = \"/var/log/fde.log\"\nlevel = \"debug\"\nsync = \"error\"\n",
+		},
+		{
+			name:    "duplicates dropped",
+			content: "[log]\nlevel = \"error\"\n level = \"info\"\n",
+			want:    "[log]\nlevel = \"debug\"\n",
+		},
+		{
+			name:    "added at the end of the table",
+			content: "[log] # logger\n# level = \"info\"\nfile = \"/var/log/fde.log\"\n\n[display]\nlevel = 2\n",
+			want:    "[log] # logger\n# level = \"info\"\nfile = \"/var/log/fde.log\"\nlevel = \"debug\"\n\n[display]\nlevel = 2\n",
+		},
+		{
+			name:    "same key in another table",
+			content: "[display]\nlevel = 2\n[log]\nlevels = 2\n",
+			want:    "[display]\nlevel = 2\n[log]\nlevels = 2\nlevel = \"debug\"\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "fde", "fde_fs.toml")
+			if tt.content != "" {
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := SetValue(path, "log", "level", "debug"); err != nil {
+				t.Fatal(err)
+			}
+			got, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("SetValue() wrote %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
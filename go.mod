@@ -12,6 +12,11 @@ require (
 	golang.org/x/sys v0.13.0
 )
 
-require github.com/warlice/lumberjack v0.0.0-20260306103047-e57fea6e4fa6
+require (
+	github.com/BurntSushi/toml v1.4.0
+	github.com/warlice/lumberjack v0.0.0-20260306103047-e57fea6e4fa6
+)
+
+require github.com/klauspost/compress v1.18.0 // indirect
 
 replace github.com/warlice/lumberjack v0.0.0-20260306103047-e57fea6e4fa6 => ./lumberjack
@@ -16,10 +16,12 @@ import (
 	"golang.org/x/sys/unix"
 )
 
+var inotifyLog = logger.Component("inotify")
+
 func watchDirectory(ctx context.Context, path, fileType string, addevents, delevents chan string) {
 	fd, err := unix.InotifyInit()
 	if err != nil {
-		logger.Error("inotify_init_error", path, err)
+		inotifyLog.WithError(err).Error("inotify_init_error", "path", path)
 		return
 	}
 	defer unix.Close(fd)
@@ -31,7 +33,7 @@ func watchDirectory(ctx context.Context, path, fileType string, addevents, delev
 
 	wd, err := unix.InotifyAddWatch(fd, path, unix.IN_CREATE|unix.IN_MOVED_TO|unix.IN_DELETE|unix.IN_MOVED_FROM)
 	if err != nil {
-		logger.Error("inotify_add_watch_error", path, err)
+		inotifyLog.WithError(err).Error("inotify_add_watch_error", "path", path)
 		return
 	}
 	defer unix.InotifyRmWatch(fd, uint32(wd))
@@ -46,7 +48,7 @@ func watchDirectory(ctx context.Context, path, fileType string, addevents, delev
 			if ctx.Err() != nil {
 				return
 			}
-			logger.Error("inotify_read_error", path, err)
+			inotifyLog.WithError(err).Error("inotify_read_error", "path", path)
 			return
 		}
 
@@ -90,11 +92,12 @@ type Op string
 const (
 	ADD    Op = "add"
 	DELETE Op = "delete"
+	MODIFY Op = "modify"
 )
 
 type InotifyEvent struct {
 	FileName string
-	OpCode   Op // "add" or "delete"
+	OpCode   Op // "add", "delete" or "modify"
 }
 
 const ApplicationNotifyType = "application"
@@ -111,46 +114,12 @@ func WatchDir(ctx context.Context, dir, notifyType, fileType string) {
 	for {
 		select {
 		case event := <-addevents:
-			{
-				IEvent := InotifyEvent{
-					FileName: event,
-					OpCode:   ADD,
-				}
-				encode, err := json.Marshal(IEvent)
-				if err != nil {
-					logger.Error("json_marshal_error", event, err)
-					continue
-				}
-
-				cmd := exec.Command("waydroid", "notify", notifyType, string(encode))
-				if err := cmd.Run(); err != nil {
-					logger.Error("command_execution_error", string(encode), err)
-					continue
-				}
-			}
-
+			notifyWaydroid(notifyType, InotifyEvent{FileName: event, OpCode: ADD})
 		case event := <-delevents:
-			{
-				IEvent := InotifyEvent{
-					FileName: event,
-					OpCode:   DELETE,
-				}
-				encode, err := json.Marshal(IEvent)
-				if err != nil {
-					logger.Error("json_marshal_error", event, err)
-					continue
-				}
-				cmd := exec.Command("waydroid", "notify", notifyType, string(encode))
-				if err := cmd.Run(); err != nil {
-					logger.Error("command_execution_error", string(encode), err)
-					continue
-				}
-			}
+			notifyWaydroid(notifyType, InotifyEvent{FileName: event, OpCode: DELETE})
 		case <-ctx.Done():
-			{
-				logger.Info("context_cancelled", "inotify received context cancel")
-				return
-			}
+			inotifyLog.Info("context_cancelled", "path", dir)
+			return
 		}
 	}
 }
@@ -189,23 +158,38 @@ func (r recentPathPrefixInfo) update(newpath string) {
 	r.path = newpath
 }
 
+// notifyWaydroid forwards an event to the android side through `waydroid notify`.
+func notifyWaydroid(notifyType string, event InotifyEvent) {
+	encode, err := json.Marshal(event)
+	if err != nil {
+		inotifyLog.WithError(err).Error("json_marshal_error", "path", event.FileName)
+		return
+	}
+	cmd := exec.Command("waydroid", "notify", notifyType, string(encode))
+	if err := cmd.Run(); err != nil {
+		inotifyLog.WithError(err).Error("command_execution_error", "event", string(encode))
+	}
+}
+
+// WatchDirRecursive forwards the files added and removed under root to
+// android as notifyType events, see WatchDirRecursiveFunc.
 func WatchDirRecursive(ctx context.Context, root, rootPrefix, notifyType string) error {
-	// recursive inotify watcher implemented as a local function and used below.
-	addevents := make(chan string)
-	delevents := make(chan string)
-	// // watchRecursive watches root and all its subdirectories. rootPrefix is prefixed to
-	// // reported paths when sending on addevents/delevents. ctx cancels the whole watcher.
-	// var watchRecursive func(ctx context.Context, rootPrefix, root string, addevents, delevents chan string) error
-	// watchRecursive =
+	return WatchDirRecursiveFunc(ctx, root, rootPrefix, func(event InotifyEvent) {
+		if event.OpCode != MODIFY {
+			notifyWaydroid(notifyType, event)
+		}
+	})
+}
+
+// WatchDirRecursiveFunc watches root and all its subdirectories, calling handle
+// for every create, write and remove/rename event. The reported FileName has
+// the root replaced by rootPrefix. It blocks until ctx is cancelled.
+func WatchDirRecursiveFunc(ctx context.Context, root, rootPrefix string, handle func(InotifyEvent)) error {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		return err
 	}
-	// ensure watcher closed when function returns
-	go func() {
-		<-ctx.Done()
-		_ = watcher.Close()
-	}()
+	defer watcher.Close()
 
 	var mu sync.Mutex
 	watched := make(map[string]struct{})
@@ -239,132 +223,52 @@ func WatchDirRecursive(ctx context.Context, root, rootPrefix, notifyType string)
 
 	// initialize by adding root recursively
 	if err := addDir(root); err != nil {
-		_ = watcher.Close()
 		return err
 	}
 
-	logger.Info("watch_dir_recursive", root)
-	// event processing goroutine
-	go func() {
-		for {
-			select {
-			case event, ok := <-watcher.Events:
-				if !ok {
-					// channel closed
-					return
-				}
-				// prepare reported path with rootPrefix
-				// remove the 'root' prefix from event.Name to get a relative path
-				relPath := strings.TrimPrefix(event.Name, root)
-				reportPath := filepath.Join(rootPrefix, relPath)
-
-				// CREATE: if directory, add watchers recursively
-				if event.Op&fsnotify.Create == fsnotify.Create {
-					/*fi, err := os.Lstat(event.Name)
-					if err == nil && fi.IsDir() {
-						if recentPath.IsContainsPrefixAndUpdateAutomaticly(event.Name) {
-							continue
-						}
-						_ = addDir(event.Name)
-					}
-					*/
-					// send create event (file or dir)
-					select {
-
-					case addevents <- reportPath:
-
-					case <-ctx.Done():
-						return
-					}
-				}
-
-				// REMOVE or RENAME: treat as deletion/move away
-				if event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
-					// remove any watched subdirectories under this path
-					mu.Lock()
-					for p := range watched {
-						if p == event.Name || strings.HasPrefix(p, event.Name+string(os.PathSeparator)) {
-							_ = watcher.Remove(p)
-							delete(watched, p)
-						}
-					}
-					mu.Unlock()
-					select {
-					case delevents <- reportPath:
-
-					case <-ctx.Done():
-						return
-					}
-				}
-			case err, ok := <-watcher.Errors:
-				if !ok {
-					return
-				}
-				_ = err // optionally log errors
-			case <-ctx.Done():
-				return
+	inotifyLog.Info("watch_dir_recursive", "path", root)
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
 			}
-		}
-	}()
-
-	// print events until context cancelled
-	go func() {
-		for {
-			select {
-			case p, ok := <-addevents:
-				if !ok {
-					return
+			// remove the 'root' prefix from event.Name to get a relative path
+			relPath := strings.TrimPrefix(event.Name, root)
+			reportPath := filepath.Join(rootPrefix, relPath)
+
+			if event.Op&fsnotify.Create == fsnotify.Create {
+				// a new directory may already contain files, watch it as well
+				if fi, err := os.Lstat(event.Name); err == nil && fi.IsDir() {
+					_ = addDir(event.Name)
 				}
+				handle(InotifyEvent{FileName: reportPath, OpCode: ADD})
+			}
 
-				IEvent := InotifyEvent{
-					FileName: p,
-					OpCode:   ADD,
-				}
-				encode, err := json.Marshal(IEvent)
-				if err != nil {
-					logger.Error("json_marshal_error", p, err)
-					continue
-				}
-				cmd := exec.Command("waydroid", "notify", notifyType, string(encode))
-				if err := cmd.Run(); err != nil {
-					logger.Error("command_execution_error", string(encode), err)
-					continue
-				}
-			case p, ok := <-delevents:
-				if !ok {
-					return
-				}
-				{
-					IEvent := InotifyEvent{
-						FileName: p,
-						OpCode:   DELETE,
-					}
-					encode, err := json.Marshal(IEvent)
-					if err != nil {
-						logger.Error("json_marshal_error", p, err)
-						continue
-					}
+			if event.Op&fsnotify.Write == fsnotify.Write {
+				handle(InotifyEvent{FileName: reportPath, OpCode: MODIFY})
+			}
 
-					cmd := exec.Command("waydroid", "notify", notifyType, string(encode))
-					if err := cmd.Run(); err != nil {
-						logger.Error("command_execution_error", string(encode), err)
-						continue
+			// REMOVE or RENAME: treat as deletion/move away
+			if event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+				// remove any watched subdirectories under this path
+				mu.Lock()
+				for p := range watched {
+					if p == event.Name || strings.HasPrefix(p, event.Name+string(os.PathSeparator)) {
+						_ = watcher.Remove(p)
+						delete(watched, p)
 					}
 				}
-			case <-ctx.Done():
-				return
+				mu.Unlock()
+				handle(InotifyEvent{FileName: reportPath, OpCode: DELETE})
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
 			}
+			inotifyLog.WithError(err).Warn("watch_dir_recursive_error", "path", root)
+		case <-ctx.Done():
+			return nil
 		}
-	}()
-
-	// block until ctx done; caller may cancel to stop everything
-	<-ctx.Done()
-	// cleanup
-	mu.Lock()
-	for p := range watched {
-		_ = watcher.Remove(p)
 	}
-	mu.Unlock()
-	_ = watcher.Close()
-	return nil
 }
@@ -0,0 +1,178 @@
+package inotify
+
+import (
+	"context"
+	"errors"
+	"mime"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// AndroidExternalStorage is where media/0 of the data dir shows up inside android.
+const AndroidExternalStorage = "/storage/emulated/0"
+
+const mediaScanAction = "android.intent.action.MEDIA_SCANNER_SCAN_FILE"
+
+// AndroidWrittenXattr marks a file fde_ptfs wrote for android, whose media
+// provider already indexes it. Its value is the mtime of the file then, a
+// later change on the linux side is scanned again.
+const AndroidWrittenXattr = "user.openfde.android_written"
+
+// mediaScanDelay is how long a file has to stay quiet before it is scanned,
+// so a photo being copied in chunks is only reported once.
+const mediaScanDelay = 2 * time.Second
+
+// mediaExtensions lists the media types android's MediaStore indexes which are
+// missing from the mime table of most distributions.
+var mediaExtensions = map[string]string{
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+	".bmp":  "image/bmp",
+	".heic": "image/heic",
+	".heif": "image/heif",
+	".dng":  "image/x-adobe-dng",
+	".mp3":  "audio/mpeg",
+	".m4a":  "audio/mp4",
+	".aac":  "audio/aac",
+	".flac": "audio/flac",
+	".ogg":  "audio/ogg",
+	".opus": "audio/ogg",
+	".wav":  "audio/x-wav",
+	".amr":  "audio/amr",
+	".mid":  "audio/midi",
+	".mp4":  "video/mp4",
+	".m4v":  "video/mp4",
+	".3gp":  "video/3gpp",
+	".mkv":  "video/x-matroska",
+	".webm": "video/webm",
+	".avi":  "video/avi",
+	".mov":  "video/quicktime",
+	".ts":   "video/mp2ts",
+}
+
+// isMediaFile reports whether MediaStore is interested in the file, judged by
+// its extension.
+func isMediaFile(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	if ext == "" {
+		return false
+	}
+	mimeType, ok := mediaExtensions[ext]
+	if !ok {
+		mimeType = mime.TypeByExtension(ext)
+	}
+	return strings.HasPrefix(mimeType, "image/") ||
+		strings.HasPrefix(mimeType, "audio/") ||
+		strings.HasPrefix(mimeType, "video/")
+}
+
+// mediaScanner collapses bursts of events on the same file into a single scan
+// request once the file has been quiet for delay.
+type mediaScanner struct {
+	mu      sync.Mutex
+	delay   time.Duration
+	pending map[string]*time.Timer
+	scan    func(path string)
+}
+
+func newMediaScanner(delay time.Duration, scan func(path string)) *mediaScanner {
+	return &mediaScanner{
+		delay:   delay,
+		pending: make(map[string]*time.Timer),
+		scan:    scan,
+	}
+}
+
+func (m *mediaScanner) handle(event InotifyEvent) {
+	if !isMediaFile(event.FileName) {
+		return
+	}
+	path := event.FileName
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if timer, ok := m.pending[path]; ok {
+		timer.Reset(m.delay)
+		return
+	}
+	m.pending[path] = time.AfterFunc(m.delay, func() {
+		m.mu.Lock()
+		delete(m.pending, path)
+		m.mu.Unlock()
+		m.scan(path)
+	})
+}
+
+// stop drops the scans which have not fired yet.
+func (m *mediaScanner) stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for path, timer := range m.pending {
+		timer.Stop()
+		delete(m.pending, path)
+	}
+}
+
+// scanMediaFile asks android's media scanner to (re)index path. A path which no
+// longer exists is dropped from MediaStore by the same request.
+func scanMediaFile(path string) {
+	cmd := exec.Command("waydroid", "shell", "am", "broadcast", "-a", mediaScanAction, "-d", "file://"+path)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		inotifyLog.WithError(err).Error("media_scan_broadcast", "path", path, "output", string(output))
+		return
+	}
+	inotifyLog.Info("media_scan_broadcast", "path", path)
+}
+
+func mtimeStamp(st *unix.Stat_t) string {
+	return strconv.FormatInt(st.Mtim.Sec, 10) + "." + strconv.FormatInt(st.Mtim.Nsec, 10)
+}
+
+// MarkAndroidWritten records that android wrote the file open on fd. A file
+// system without user xattrs is left alone, its files being scanned twice.
+func MarkAndroidWritten(fd int) error {
+	var st unix.Stat_t
+	if err := unix.Fstat(fd, &st); err != nil {
+		return err
+	}
+	err := unix.Fsetxattr(fd, AndroidWrittenXattr, []byte(mtimeStamp(&st)), 0)
+	if errors.Is(err, unix.ENOTSUP) {
+		return nil
+	}
+	return err
+}
+
+// writtenByAndroid tells whether the file at path is unchanged since
+// android wrote it through fde_ptfs.
+func writtenByAndroid(path string) bool {
+	var st unix.Stat_t
+	if err := unix.Stat(path, &st); err != nil {
+		return false
+	}
+	buf := make([]byte, 64)
+	n, err := unix.Getxattr(path, AndroidWrittenXattr, buf)
+	return err == nil && string(buf[:n]) == mtimeStamp(&st)
+}
+
+// WatchMediaScan watches the linux personal folder linuxDir and asks android to
+// scan the created, modified and deleted media files under androidDir, the path
+// the folder is fused to on the android side. It blocks until ctx is cancelled.
+func WatchMediaScan(ctx context.Context, linuxDir, androidDir string) error {
+	scanner := newMediaScanner(mediaScanDelay, func(path string) {
+		if writtenByAndroid(filepath.Join(linuxDir, strings.TrimPrefix(path, androidDir))) {
+			inotifyLog.Debug("media_scan_skipped", "path", path)
+			return
+		}
+		scanMediaFile(path)
+	})
+	defer scanner.stop()
+	return WatchDirRecursiveFunc(ctx, linuxDir, androidDir, scanner.handle)
+}
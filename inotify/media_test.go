@@ -0,0 +1,97 @@
+package inotify
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func Test_isMediaFile(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{name: "/storage/emulated/0/Pictures/a.jpg", want: true},
+		{name: "/storage/emulated/0/Pictures/A.JPG", want: true},
+		{name: "/storage/emulated/0/Music/b.flac", want: true},
+		{name: "/storage/emulated/0/Movies/c.mkv", want: true},
+		{name: "/storage/emulated/0/Documents/d.txt", want: false},
+		{name: "/storage/emulated/0/Pictures/.e.jpg.part", want: false},
+		{name: "/storage/emulated/0/Pictures/noext", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isMediaFile(tt.name); got != tt.want {
+				t.Errorf("isMediaFile() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_mediaScannerDebounce(t *testing.T) {
+	var mu sync.Mutex
+	scanned := make(map[string]int)
+	done := make(chan struct{}, 2)
+	scanner := newMediaScanner(20*time.Millisecond, func(path string) {
+		mu.Lock()
+		scanned[path]++
+		mu.Unlock()
+		done <- struct{}{}
+	})
+	defer scanner.stop()
+
+	for i := 0; i < 5; i++ {
+		scanner.handle(InotifyEvent{FileName: "/p/a.jpg", OpCode: MODIFY})
+	}
+	scanner.handle(InotifyEvent{FileName: "/p/b.png", OpCode: ADD})
+	scanner.handle(InotifyEvent{FileName: "/p/c.txt", OpCode: ADD})
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for scans")
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if len(scanned) != 2 || scanned["/p/a.jpg"] != 1 || scanned["/p/b.png"] != 1 {
+		t.Errorf("scanned = %v, want a.jpg and b.png once", scanned)
+	}
+}
+
+func Test_writtenByAndroid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.jpg")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if writtenByAndroid(path) {
+		t.Error("writtenByAndroid() of a file written on the linux side")
+	}
+	if err := MarkAndroidWritten(int(f.Fd())); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 64)
+	if _, err := unix.Getxattr(path, AndroidWrittenXattr, buf); errors.Is(err, unix.ENOTSUP) {
+		t.Skip("no user xattrs on", path)
+	}
+	if !writtenByAndroid(path) {
+		t.Error("writtenByAndroid() of a file marked = false")
+	}
+	//changed on the linux side afterwards
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if writtenByAndroid(path) {
+		t.Error("writtenByAndroid() of a file changed since = true")
+	}
+}
@@ -0,0 +1,211 @@
+package logger
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	componentKey = "component"
+	opKey        = "op"
+	opIDKey      = "op_id"
+	errorKey     = "error"
+	errnoKey     = "errno"
+	badKey       = "!BADKEY"
+)
+
+// Entry is a logger bound to a component, an optional operation and a set of
+// key/value fields, all of them added to every line it writes. Entries are
+// immutable, the With* methods return a copy.
+//
+//	log := logger.Component("volumes").Op("mount").With("mountpoint", path)
+//	log.Info("mount_volume")
+//	log.WithError(err).Error("mount_fuse_error", "root", root)
+type Entry struct {
+	fields logrus.Fields
+}
+
+// Component returns the logger of one part of fde_fs, e.g. "volumes" or "ptfs".
+func Component(name string) *Entry {
+	return &Entry{fields: logrus.Fields{componentKey: name}}
+}
+
+func (e *Entry) clone(extra int) *Entry {
+	fields := make(logrus.Fields, len(e.fields)+extra)
+	for k, v := range e.fields {
+		fields[k] = v
+	}
+	return &Entry{fields: fields}
+}
+
+// With adds key/value pairs. A key without value is logged under !BADKEY.
+func (e *Entry) With(keysAndValues ...interface{}) *Entry {
+	c := e.clone(len(keysAndValues) / 2)
+	addKeysAndValues(c.fields, keysAndValues)
+	return c
+}
+
+// WithError records err, and the errno name (ENOENT, EACCES...) when err
+// carries a syscall.Errno.
+func (e *Entry) WithError(err error) *Entry {
+	if err == nil {
+		return e
+	}
+	c := e.clone(2)
+	c.fields[errorKey] = err.Error()
+	if name := ErrnoName(err); name != "" {
+		c.fields[errnoKey] = name
+	}
+	return c
+}
+
+// Op starts a new operation, such as a mount attempt or a FUSE request. The
+// returned Entry tags every line with the operation name and a fresh id.
+func (e *Entry) Op(op string) *Entry {
+	c := e.clone(2)
+	c.fields[opKey] = op
+	c.fields[opIDKey] = NewOpID()
+	return c
+}
+
+// OpID returns the id of the current operation, empty outside of one.
+func (e *Entry) OpID() string {
+	id, _ := e.fields[opIDKey].(string)
+	return id
+}
+
+func (e *Entry) Trace(event string, keysAndValues ...interface{}) {
+	e.log(logrus.TraceLevel, event, keysAndValues)
+}
+
+func (e *Entry) Debug(event string, keysAndValues ...interface{}) {
+	e.log(logrus.DebugLevel, event, keysAndValues)
+}
+
+func (e *Entry) Info(event string, keysAndValues ...interface{}) {
+	e.log(logrus.InfoLevel, event, keysAndValues)
+}
+
+func (e *Entry) Warn(event string, keysAndValues ...interface{}) {
+	e.log(logrus.WarnLevel, event, keysAndValues)
+}
+
+func (e *Entry) Error(event string, keysAndValues ...interface{}) {
+	e.log(logrus.ErrorLevel, event, keysAndValues)
+}
+
+func (e *Entry) log(level logrus.Level, event string, keysAndValues []interface{}) {
+	if !Logger.IsLevelEnabled(level) {
+		return
+	}
+	fields := make(logrus.Fields, len(e.fields)+len(keysAndValues)/2+1)
+	for k, v := range e.fields {
+		fields[k] = v
+	}
+	addKeysAndValues(fields, keysAndValues)
+	fields["from"] = event
+	Logger.WithFields(fields).Log(level)
+}
+
+func addKeysAndValues(fields logrus.Fields, keysAndValues []interface{}) {
+	for i := 0; i < len(keysAndValues); i += 2 {
+		key, ok := keysAndValues[i].(string)
+		if !ok {
+			key = fmt.Sprint(keysAndValues[i])
+		}
+		if i+1 == len(keysAndValues) {
+			fields[badKey] = keysAndValues[i]
+			return
+		}
+		value := keysAndValues[i+1]
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+		fields[key] = value
+	}
+}
+
+var (
+	opPrefix  = newOpPrefix()
+	opCounter uint64
+)
+
+func newOpPrefix() string {
+	b := make([]byte, 3)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.Itoa(syscall.Getpid())
+	}
+	return hex.EncodeToString(b)
+}
+
+// NewOpID returns an id unique across processes for an operation, cheap
+// enough to be taken for every FUSE request.
+func NewOpID() string {
+	return opPrefix + "-" + strconv.FormatUint(atomic.AddUint64(&opCounter, 1), 36)
+}
+
+// ErrnoName returns the symbolic name of the errno wrapped in err, e.g.
+// "ENOTCONN", or an empty string.
+func ErrnoName(err error) string {
+	var errno syscall.Errno
+	if !errors.As(err, &errno) {
+		return ""
+	}
+	if name := unix.ErrnoName(errno); name != "" {
+		return name
+	}
+	return "errno " + strconv.Itoa(int(errno))
+}
+
+// OpError wraps the error of a system call made on a path.
+type OpError struct {
+	Op   string
+	Path string
+	Err  error
+}
+
+// Wrap returns err annotated with the operation and the path it failed on,
+// nil if err is nil. The errno name shows up in the message, e.g.
+// "unmount /var/lib/fde/volumes/xx: EBUSY (device or resource busy)".
+func Wrap(op, path string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &OpError{Op: op, Path: path, Err: err}
+}
+
+func (e *OpError) Error() string {
+	if name := ErrnoName(e.Err); name != "" {
+		return e.Op + " " + e.Path + ": " + name + " (" + e.Err.Error() + ")"
+	}
+	return e.Op + " " + e.Path + ": " + e.Err.Error()
+}
+
+func (e *OpError) Unwrap() error {
+	return e.Err
+}
+
+type entryKey struct{}
+
+// NewContext returns a copy of ctx carrying e, so an operation can be
+// followed across functions and goroutines.
+func NewContext(ctx context.Context, e *Entry) context.Context {
+	return context.WithValue(ctx, entryKey{}, e)
+}
+
+// FromContext returns the Entry stored by NewContext, or fallback.
+func FromContext(ctx context.Context, fallback *Entry) *Entry {
+	if e, ok := ctx.Value(entryKey{}).(*Entry); ok {
+		return e
+	}
+	return fallback
+}
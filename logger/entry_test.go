@@ -0,0 +1,66 @@
+package logger
+
+import (
+	"errors"
+	"syscall"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func Test_EntryFields(t *testing.T) {
+	hook := test.NewLocal(Logger.Logger)
+	defer hook.Reset()
+	level := Logger.GetLevel()
+	Logger.SetLevel(logrus.InfoLevel)
+	defer Logger.SetLevel(level)
+
+	log := Component("volumes").Op("mount").With("mountpoint", "/var/lib/fde/volumes/x")
+	log.WithError(Wrap("unmount", "/var/lib/fde/volumes/x", syscall.EBUSY)).Error("umount_volumes", "retry", 1, "dangling")
+	log.Debug("filtered_out")
+
+	if len(hook.AllEntries()) != 1 {
+		t.Fatalf("got %d entries, want 1", len(hook.AllEntries()))
+	}
+	data := hook.LastEntry().Data
+	want := logrus.Fields{
+		"component":  "volumes",
+		"op":         "mount",
+		"op_id":      log.OpID(),
+		"mountpoint": "/var/lib/fde/volumes/x",
+		"from":       "umount_volumes",
+		"retry":      1,
+		"errno":      "EBUSY",
+		"error":      "unmount /var/lib/fde/volumes/x: EBUSY (device or resource busy)",
+		"!BADKEY":    "dangling",
+	}
+	for k, v := range want {
+		if data[k] != v {
+			t.Errorf("field %s = %v, want %v", k, data[k], v)
+		}
+	}
+}
+
+func Test_EntryIsImmutable(t *testing.T) {
+	base := Component("ptfs")
+	child := base.With("path", "/a").Op("open")
+	if _, ok := base.fields["path"]; ok {
+		t.Error("With modified the parent entry")
+	}
+	if base.OpID() != "" || child.OpID() == "" {
+		t.Errorf("OpID() parent %q child %q", base.OpID(), child.OpID())
+	}
+	if other := base.Op("open"); other.OpID() == child.OpID() {
+		t.Errorf("two operations share the id %q", other.OpID())
+	}
+}
+
+func Test_ErrnoName(t *testing.T) {
+	if got := ErrnoName(errors.New("plain")); got != "" {
+		t.Errorf("ErrnoName(plain) = %q", got)
+	}
+	if got := ErrnoName(Wrap("stat", "/x", syscall.ENOTCONN)); got != "ENOTCONN" {
+		t.Errorf("ErrnoName(ENOTCONN) = %q", got)
+	}
+}
@@ -0,0 +1,156 @@
+package logger
+
+import (
+	"errors"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"syscall"
+
+	"github.com/warlice/lumberjack"
+)
+
+// logGroup may read the system log, like the other files of /var/log.
+const logGroup = "adm"
+
+// logFileCandidate is a place the log file may be written to, with the
+// permissions it gets when created.
+type logFileCandidate struct {
+	path     string
+	dirMode  os.FileMode
+	fileMode os.FileMode
+	uid      int
+	gid      int
+}
+
+// logFileCandidates lists where to write the log file, in order of preference:
+// log.file, then the per-user log under $XDG_STATE_HOME.
+func logFileCandidates() []logFileCandidate {
+	candidates := []logFileCandidate{{
+		path:     logFile,
+		dirMode:  0755,
+		fileMode: 0640,
+		uid:      0,
+		gid:      lookupGroup(logGroup),
+	}}
+	if userLog := userLogFile(); userLog != "" {
+		candidates = append(candidates, logFileCandidate{
+			path:     userLog,
+			dirMode:  0700,
+			fileMode: 0600,
+			uid:      os.Getuid(),
+			gid:      os.Getgid(),
+		})
+	}
+	return candidates
+}
+
+// userLogFile returns $XDG_STATE_HOME/openfde/fde.log, XDG_STATE_HOME
+// defaulting to ~/.local/state.
+func userLogFile() string {
+	stateHome := os.Getenv("XDG_STATE_HOME")
+	if !filepath.IsAbs(stateHome) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		stateHome = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(stateHome, "openfde", filepath.Base(logFile))
+}
+
+func lookupGroup(name string) int {
+	group, err := user.LookupGroup(name)
+	if err != nil {
+		return 0
+	}
+	gid, err := strconv.Atoi(group.Gid)
+	if err != nil {
+		return 0
+	}
+	return gid
+}
+
+// openLogFile returns the first candidate which can be written to, creating
+// it and its parent directories with the candidate's permissions. The errors
+// of the skipped candidates are returned by path.
+func openLogFile(candidates []logFileCandidate) (*logFileCandidate, map[string]string) {
+	failed := make(map[string]string)
+	for i, candidate := range candidates {
+		if err := candidate.prepare(); err != nil {
+			failed[candidate.path] = err.Error()
+			continue
+		}
+		return &candidates[i], failed
+	}
+	return nil, failed
+}
+
+// apply gives l the permissions of the candidate, so the rotated files and
+// backups keep them.
+func (candidate logFileCandidate) apply(l *lumberjack.Logger) {
+	l.FileMode = candidate.fileMode
+	if syscall.Geteuid() == 0 {
+		l.Owner = strconv.Itoa(candidate.uid)
+		l.Group = strconv.Itoa(candidate.gid)
+	}
+}
+
+// prepare makes sure the log file exists and is writable. A file left world
+// writable by older versions gets the candidate's mode back.
+func (candidate logFileCandidate) prepare() error {
+	if err := mkdirAllOwned(filepath.Dir(candidate.path), candidate.dirMode, candidate.uid, candidate.gid); err != nil {
+		return err
+	}
+	_, statErr := os.Stat(candidate.path)
+	created := errors.Is(statErr, os.ErrNotExist)
+	f, err := os.OpenFile(candidate.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, candidate.fileMode)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if created || info.Mode().Perm()&0002 != 0 {
+		// the mode given to OpenFile went through the umask
+		if err := f.Chmod(candidate.fileMode); err != nil {
+			return err
+		}
+		if err := chownIfRoot(f.Chown, candidate.uid, candidate.gid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mkdirAllOwned is os.MkdirAll, handing every directory it creates to uid:gid
+// so a setuid process does not leave root owned directories in the user's home.
+func mkdirAllOwned(dir string, mode os.FileMode, uid, gid int) error {
+	if _, err := os.Stat(dir); err == nil {
+		return nil
+	}
+	if parent := filepath.Dir(dir); parent != dir {
+		if err := mkdirAllOwned(parent, mode, uid, gid); err != nil {
+			return err
+		}
+	}
+	if err := os.Mkdir(dir, mode); err != nil && !errors.Is(err, os.ErrExist) {
+		return err
+	}
+	if err := os.Chmod(dir, mode); err != nil {
+		return err
+	}
+	return chownIfRoot(func(uid, gid int) error { return os.Chown(dir, uid, gid) }, uid, gid)
+}
+
+// chownIfRoot changes the ownership when running as root, anybody else can
+// only create files owned by themselves anyway.
+func chownIfRoot(chown func(uid, gid int) error, uid, gid int) error {
+	if syscall.Geteuid() != 0 {
+		return nil
+	}
+	return chown(uid, gid)
+}
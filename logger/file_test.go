@@ -0,0 +1,62 @@
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_openLogFileFallback(t *testing.T) {
+	dir := t.TempDir()
+	notDir := filepath.Join(dir, "file")
+	if err := os.WriteFile(notDir, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	userLog := filepath.Join(dir, "state", "openfde", "fde.log")
+	candidates := []logFileCandidate{
+		{path: filepath.Join(notDir, "fde.log"), dirMode: 0755, fileMode: 0640, uid: os.Getuid(), gid: os.Getgid()},
+		{path: userLog, dirMode: 0700, fileMode: 0600, uid: os.Getuid(), gid: os.Getgid()},
+	}
+	candidate, failed := openLogFile(candidates)
+	if candidate == nil || candidate.path != userLog {
+		t.Fatalf("openLogFile() = %v, want %q", candidate, userLog)
+	}
+	if _, ok := failed[candidates[0].path]; !ok {
+		t.Errorf("openLogFile() failed = %v, want %q reported", failed, candidates[0].path)
+	}
+	info, err := os.Stat(userLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("log file mode = %v, want 0600", info.Mode().Perm())
+	}
+	info, err = os.Stat(filepath.Dir(userLog))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0700 {
+		t.Errorf("log dir mode = %v, want 0700", info.Mode().Perm())
+	}
+}
+
+func Test_prepareTightensWorldWritable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fde.log")
+	if err := os.WriteFile(path, []byte("old\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(path, 0666); err != nil {
+		t.Fatal(err)
+	}
+	candidate := logFileCandidate{path: path, dirMode: 0755, fileMode: 0640, uid: os.Getuid(), gid: os.Getgid()}
+	if err := candidate.prepare(); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("log file mode = %v, want 0640", info.Mode().Perm())
+	}
+}
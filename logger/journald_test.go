@@ -0,0 +1,86 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func Test_journalEntry(t *testing.T) {
+	entry := &logrus.Entry{
+		Level: logrus.WarnLevel,
+		Data: logrus.Fields{
+			"LINE":      "fde_fs/volumes.go:42",
+			"from":      "mount_volume",
+			"source":    map[string]int{"uid": 1000},
+			"mount-id":  7,
+			"_internal": "x",
+		},
+	}
+	got := string(journalEntry(entry, "fde_fs"))
+	for _, want := range []string{
+		"MESSAGE=mount_volume: {\"uid\":1000}\n",
+		"PRIORITY=4\n",
+		"SYSLOG_IDENTIFIER=fde_fs\n",
+		"CODE_FILE=fde_fs/volumes.go\n",
+		"CODE_LINE=42\n",
+		"FDE_FROM=mount_volume\n",
+		"FDE_SOURCE={\"uid\":1000}\n",
+		"MOUNT_ID=7\n",
+		"INTERNAL=x\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("journalEntry() = %q, missing %q", got, want)
+		}
+	}
+}
+
+func Test_appendJournalFieldMultiline(t *testing.T) {
+	var buf bytes.Buffer
+	appendJournalField(&buf, "FDE_SOURCE", "a\nb")
+	var want bytes.Buffer
+	want.WriteString("FDE_SOURCE\n")
+	binary.Write(&want, binary.LittleEndian, uint64(3))
+	want.WriteString("a\nb\n")
+	if !bytes.Equal(buf.Bytes(), want.Bytes()) {
+		t.Errorf("appendJournalField() = %q, want %q", buf.Bytes(), want.Bytes())
+	}
+}
+
+func Test_journalHookFire(t *testing.T) {
+	addr := &net.UnixAddr{Name: filepath.Join(t.TempDir(), "socket"), Net: "unixgram"}
+	server, err := net.ListenUnixgram("unixgram", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	hook := &journalHook{conn: conn, addr: addr, identifier: "fde_fs"}
+
+	entry := &logrus.Entry{
+		Level: logrus.ErrorLevel,
+		Data:  logrus.Fields{"from": "umount_volumes", "errors": []logrus.Fields{generateErrorFields(errors.New("busy"))}},
+	}
+	if err := hook.Fire(entry); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 4096)
+	n, err := server.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(buf[:n])
+	if !strings.Contains(got, "PRIORITY=3\n") || !strings.Contains(got, "FDE_ERRORS=[{\"err\":\"busy\"}]\n") {
+		t.Errorf("received %q", got)
+	}
+}
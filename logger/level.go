@@ -0,0 +1,129 @@
+package logger
+
+import (
+	"fde_fs/config"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	levelKey     = "level"
+	levelEnv     = "FDE_LOG_LEVEL"
+	defaultLevel = logrus.ErrorLevel
+	// signals never step the level below errors
+	minSignalLevel = logrus.ErrorLevel
+)
+
+// ParseLevel accepts a level name ("info", "warn", ...) or its logrus number.
+func ParseLevel(levelStr string) (logrus.Level, error) {
+	levelStr = strings.TrimSpace(levelStr)
+	if lvl, err := logrus.ParseLevel(strings.ToLower(levelStr)); err == nil {
+		return lvl, nil
+	}
+	if n, err := strconv.Atoi(levelStr); err == nil && n >= int(logrus.PanicLevel) && n <= int(logrus.TraceLevel) {
+		return logrus.Level(n), nil
+	}
+	return defaultLevel, fmt.Errorf("invalid log level %q", levelStr)
+}
+
+// startupLevel picks FDE_LOG_LEVEL first, then log.level of the
+// configuration.
+func startupLevel() logrus.Level {
+	if levelStr := strings.TrimSpace(os.Getenv(levelEnv)); levelStr != "" {
+		if lvl, err := ParseLevel(levelStr); err == nil {
+			return lvl
+		}
+	}
+	return configuredLevel(config.Get())
+}
+
+// configuredLevel returns log.level of cfg, or the default level.
+func configuredLevel(cfg *config.Config) logrus.Level {
+	lvl, _ := ParseLevel(cfg.Log.Level)
+	return lvl
+}
+
+// SetLevel changes the level of Logger and records the change. The record is
+// written at info level, or at the more verbose of both levels when that is
+// lower, so it is visible whichever way the level moved.
+func SetLevel(level logrus.Level) {
+	old := Logger.GetLevel()
+	if old == level {
+		return
+	}
+	entryLevel := old
+	if level > old {
+		entryLevel = level
+		Logger.SetLevel(level)
+	}
+	if entryLevel > logrus.InfoLevel {
+		entryLevel = logrus.InfoLevel
+	}
+	buildLogEntry("log_level_changed", map[string]string{
+		"old": old.String(),
+		"new": level.String(),
+	}).Log(entryLevel)
+	Logger.SetLevel(level)
+}
+
+// LevelUp makes Logger one step more verbose.
+func LevelUp() {
+	if level := Logger.GetLevel(); level < logrus.TraceLevel {
+		SetLevel(level + 1)
+	}
+}
+
+// LevelDown makes Logger one step less verbose, but keeps errors.
+func LevelDown() {
+	if level := Logger.GetLevel(); level > minSignalLevel {
+		SetLevel(level - 1)
+	}
+}
+
+// ReloadLevel applies log.level as config.SystemFile sets it now. The file
+// is left alone if it is invalid.
+func ReloadLevel() {
+	cfg, errs := config.Load(config.SystemFile, "")
+	if len(errs) > 0 {
+		Logger.WithError(errs[0]).Warn("reload_log_level_failed")
+		return
+	}
+	SetLevel(configuredLevel(cfg))
+}
+
+// SaveLevel persists level as log.level of config.SystemFile, keeping the
+// other settings.
+func SaveLevel(level logrus.Level) error {
+	return config.SetValue(config.SystemFile, "log", levelKey, level.String())
+}
+
+var watchLevelOnce sync.Once
+
+// WatchLevelSignals lets a running process change its level:
+// SIGUSR1 raises the verbosity, SIGUSR2 lowers it and SIGHUP re-reads
+// config.SystemFile.
+func WatchLevelSignals() {
+	watchLevelOnce.Do(func() {
+		sigCh := make(chan os.Signal, 1)
+		signal.Notify(sigCh, syscall.SIGUSR1, syscall.SIGUSR2, syscall.SIGHUP)
+		go func() {
+			for sig := range sigCh {
+				switch sig {
+				case syscall.SIGUSR1:
+					LevelUp()
+				case syscall.SIGUSR2:
+					LevelDown()
+				case syscall.SIGHUP:
+					ReloadLevel()
+				}
+			}
+		}()
+	})
+}
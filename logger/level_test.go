@@ -0,0 +1,105 @@
+package logger
+
+import (
+	"fde_fs/config"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func Test_ParseLevel(t *testing.T) {
+	tests := []struct {
+		levelStr string
+		want     logrus.Level
+		wantErr  bool
+	}{
+		{levelStr: "info", want: logrus.InfoLevel},
+		{levelStr: "WARN", want: logrus.WarnLevel},
+		{levelStr: " Debug ", want: logrus.DebugLevel},
+		{levelStr: "warning", want: logrus.WarnLevel},
+		{levelStr: "trace", want: logrus.TraceLevel},
+		{levelStr: "0", want: logrus.PanicLevel},
+		{levelStr: "6", want: logrus.TraceLevel},
+		{levelStr: "7", want: defaultLevel, wantErr: true},
+		{levelStr: "-1", want: defaultLevel, wantErr: true},
+		{levelStr: "verbose", want: defaultLevel, wantErr: true},
+		{levelStr: "", want: defaultLevel, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseLevel(tt.levelStr)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseLevel(%q) error = %v, wantErr %v", tt.levelStr, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("ParseLevel(%q) = %v, want %v", tt.levelStr, got, tt.want)
+		}
+	}
+}
+
+func Test_LevelUpDown(t *testing.T) {
+	level := Logger.GetLevel()
+	defer Logger.SetLevel(level)
+	tests := []struct {
+		name string
+		from logrus.Level
+		step func()
+		want logrus.Level
+	}{
+		{name: "up", from: logrus.InfoLevel, step: LevelUp, want: logrus.DebugLevel},
+		{name: "up at trace", from: logrus.TraceLevel, step: LevelUp, want: logrus.TraceLevel},
+		{name: "down", from: logrus.InfoLevel, step: LevelDown, want: logrus.WarnLevel},
+		{name: "down at error", from: logrus.ErrorLevel, step: LevelDown, want: logrus.ErrorLevel},
+		{name: "down below error", from: logrus.FatalLevel, step: LevelDown, want: logrus.FatalLevel},
+	}
+	for _, tt := range tests {
+		Logger.SetLevel(tt.from)
+		tt.step()
+		if got := Logger.GetLevel(); got != tt.want {
+			t.Errorf("%s: level = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func Test_SaveLevel(t *testing.T) {
+	systemFile := config.SystemFile
+	level := Logger.GetLevel()
+	defer func() {
+		config.SystemFile = systemFile
+		Logger.SetLevel(level)
+	}()
+	config.SystemFile = filepath.Join(t.TempDir(), "fde", "fde_fs.toml")
+	if err := os.MkdirAll(filepath.Dir(config.SystemFile), 0755); err != nil {
+		t.Fatal(err)
+	}
+	content := "# fde\n[log]\nfile = \"/var/log/fde.log\"\nlevel = \"error\"\n"
+	if err := os.WriteFile(config.SystemFile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SaveLevel(logrus.DebugLevel); err != nil {
+		t.Fatal(err)
+	}
+	Logger.SetLevel(logrus.ErrorLevel)
+	ReloadLevel()
+	if got := Logger.GetLevel(); got != logrus.DebugLevel {
+		t.Errorf("level after ReloadLevel() = %v, want debug", got)
+	}
+	got, err := os.ReadFile(config.SystemFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "# fde\n[log]\nfile = \"/var/log/fde.log\"\nlevel = \"debug\"\n"; string(got) != want {
+		t.Errorf("SaveLevel() wrote %q, want %q", got, want)
+	}
+
+	//an invalid file keeps the level
+	if err := os.WriteFile(config.SystemFile, []byte("[log]\nlevel = \"loud\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ReloadLevel()
+	if got := Logger.GetLevel(); got != logrus.DebugLevel {
+		t.Errorf("level after reloading an invalid file = %v, want debug", got)
+	}
+}
@@ -1,10 +1,7 @@
 package logger
 
 import (
-	"os"
-	"strconv"
-	"syscall"
-	"strings"
+	"fde_fs/config"
 
 	"github.com/sirupsen/logrus"
 	"github.com/warlice/lumberjack"
@@ -19,27 +16,13 @@ var (
 	Logger = NewLogger() //Logger New logger by loggerSentry and loggerLine
 )
 
-var logFile = "/var/log/fde.log"
+var logFile = config.Get().Log.File
 
 func Init() *StandardLogger {
 	var baseLogger = logrus.New()
 	var standard = &StandardLogger{baseLogger}
 
-	levelStr := strings.TrimSpace(os.Getenv("FDE_LOG_LEVEL"))
-	if levelStr == "" {
-		standard.SetLevel(logrus.ErrorLevel)
-	} else {
-		// try parse as level name first (e.g., "info", "warn")
-		if lvl, err := logrus.ParseLevel(strings.ToLower(levelStr)); err == nil {
-			standard.SetLevel(lvl)
-		} else if n, err := strconv.Atoi(levelStr); err == nil {
-			// fall back to numeric level
-			standard.SetLevel(logrus.Level(n))
-		} else {
-			// invalid value, use default
-			standard.SetLevel(logrus.ErrorLevel)
-		}
-	}
+	standard.SetLevel(startupLevel())
 
 	standard.Formatter = &logrus.JSONFormatter{}
 	return standard
@@ -59,19 +42,10 @@ func Rotate() {
 // NewLogger New logger by  loggerLine
 func NewLogger() *StandardLogger {
 	standard := Init()
-	syscall.Umask(0)
-	logName := logFile
-	if len(logName) != 0 {
-		LumberLogger = &lumberjack.Logger{
-			Filename:   logName,
-			MaxSize:    10, // megabytes
-			MaxBackups: 1,
-			MaxAge:     30,   //days
-			Compress:   true, // disabled by default
-		}
-		standard.SetOutput(LumberLogger)
-	}
 	standard.loggerLine()
+	//after the LINE hook, before the journald and syslog ones
+	standard.Hooks.Add(redactor)
+	standard.setupOutputs(outputTargets())
 	return standard
 }
 
@@ -80,7 +54,7 @@ func UpdateLoggerLevel(Level uint32) {
 	if level > logrus.TraceLevel || level == 0 {
 		level = logrus.TraceLevel
 	}
-	Logger.SetLevel(level)
+	SetLevel(level)
 }
 
 // loggerLine for print log with line
@@ -0,0 +1,158 @@
+package logger
+
+import (
+	"fde_fs/config"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/warlice/lumberjack"
+)
+
+// Output targets, selected with FDE_LOG_OUTPUT as a comma separated list,
+// e.g. "journald,file", or by log.output of the configuration.
+const (
+	OutputFile     = "file"
+	OutputStderr   = "stderr"
+	OutputJournald = "journald"
+	OutputSyslog   = "syslog"
+)
+
+const (
+	outputEnv     = "FDE_LOG_OUTPUT"
+	defaultOutput = OutputFile
+)
+
+// rotationInterval returns how often the log file is rotated besides its size
+// limit, from log.rotate: "daily", "hourly" or "off".
+func rotationInterval() time.Duration {
+	switch config.Get().Log.Rotate {
+	case "hourly":
+		return time.Hour
+	case "daily":
+		return 24 * time.Hour
+	default:
+		return 0
+	}
+}
+
+// compression returns how rotated log files are compressed, from
+// log.compression, e.g. "zstd" or "gzip:9". Empty means gzip at its default
+// level.
+func compression() string {
+	return config.Get().Log.Compression
+}
+
+// outputTargets returns the outputs of FDE_LOG_OUTPUT first, then of
+// log.output. Unknown and repeated names are dropped.
+func outputTargets() []string {
+	outputs := config.Get().Log.Output
+	if value := strings.TrimSpace(os.Getenv(outputEnv)); value != "" {
+		outputs = strings.Split(value, ",")
+	}
+	var targets []string
+	seen := make(map[string]bool)
+	for _, target := range outputs {
+		target = strings.ToLower(strings.TrimSpace(target))
+		switch target {
+		case OutputFile, OutputStderr, OutputJournald, OutputSyslog:
+			if !seen[target] {
+				seen[target] = true
+				targets = append(targets, target)
+			}
+		}
+	}
+	if len(targets) == 0 {
+		targets = []string{defaultOutput}
+	}
+	return targets
+}
+
+// setupOutputs points the logger at the given targets. The file and stderr
+// targets receive the JSON lines, journald and syslog are fed by hooks which
+// must run after the LINE hook. If no log file is writable, or no target can
+// be set up at all, the logger falls back to stderr.
+func (logger *StandardLogger) setupOutputs(targets []string) {
+	var writers []io.Writer
+	var hooks int
+	failed := make(map[string]string)
+	policy := logSyncPolicy()
+	for _, target := range targets {
+		switch target {
+		case OutputFile:
+			candidate, skipped := openLogFile(logFileCandidates())
+			for skippedPath, reason := range skipped {
+				failed[skippedPath] = reason
+			}
+			if candidate == nil {
+				failed[target] = "no writable log file"
+				if !contains(targets, OutputStderr) {
+					writers = append(writers, os.Stderr)
+				}
+				continue
+			}
+			LumberLogger = &lumberjack.Logger{
+				Filename:         candidate.path,
+				MaxSize:          10,   // megabytes
+				MaxBackups:       7,    // a week of logs when rotated daily
+				MaxTotalSize:     50,   // megabytes, /var is small on thin clients
+				MaxAge:           30,   //days
+				Compress:         true, // disabled by default
+				Compression:      compression(),
+				LocalTime:        true, // backups named after the user's day
+				RotationInterval: rotationInterval(),
+			}
+			candidate.apply(LumberLogger)
+			policy.apply(LumberLogger)
+			writers = append(writers, LumberLogger)
+		case OutputStderr:
+			writers = append(writers, os.Stderr)
+		case OutputJournald:
+			hook, err := newJournalHook()
+			if err != nil {
+				failed[target] = err.Error()
+				continue
+			}
+			logger.Hooks.Add(hook)
+			hooks++
+		case OutputSyslog:
+			hook, err := newSyslogHook()
+			if err != nil {
+				failed[target] = err.Error()
+				continue
+			}
+			logger.Hooks.Add(hook)
+			hooks++
+		}
+	}
+	switch {
+	case len(writers) > 1:
+		logger.SetOutput(io.MultiWriter(writers...))
+	case len(writers) == 1:
+		logger.SetOutput(writers[0])
+	case hooks > 0:
+		logger.SetOutput(io.Discard)
+	default:
+		logger.SetOutput(os.Stderr)
+	}
+	if policy.onError && LumberLogger != nil && len(writers) > 0 {
+		logger.syncOnError(LumberLogger)
+	}
+	if len(failed) > 0 {
+		logger.WithFields(logrus.Fields{
+			"from":   "log_output_unavailable",
+			"source": failed,
+		}).Warn()
+	}
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
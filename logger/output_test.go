@@ -0,0 +1,25 @@
+package logger
+
+import (
+	"fde_fs/config"
+	"reflect"
+	"testing"
+)
+
+func Test_outputTargets(t *testing.T) {
+	tests := []struct {
+		env  string
+		want []string
+	}{
+		{env: "", want: config.Get().Log.Output},
+		{env: "stderr", want: []string{OutputStderr}},
+		{env: " Journald, file ,journald", want: []string{OutputJournald, OutputFile}},
+		{env: "printer", want: []string{defaultOutput}},
+	}
+	for _, tt := range tests {
+		t.Setenv(outputEnv, tt.env)
+		if got := outputTargets(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("outputTargets() with %s=%q = %v, want %v", outputEnv, tt.env, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package logger
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fde_fs/config"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/sirupsen/logrus"
+)
+
+// machineIDFile salts the hashes, so they cannot be matched against a list
+// of common file names.
+const machineIDFile = "/etc/machine-id"
+
+var (
+	// pathPattern finds the paths embedded in a message, a path spanning up
+	// to the next space or punctuation
+	pathPattern = regexp.MustCompile(`/[^\s"',;:()\[\]{}]+`)
+	// homePattern matches the home directories which are not known by name
+	homePattern = regexp.MustCompile(`^/home/[^/]+`)
+	// media0Pattern matches the android shared storage kept under the home,
+	// ~/.local/share/openfdeXX/media/0
+	media0Pattern = regexp.MustCompile(`/\.local/share/openfde[^/]*/media/0/`)
+)
+
+// androidStorage is the shared storage as seen from android.
+const androidStorage = "/storage/emulated/0/"
+
+// redactHook keeps the user's privacy in the world readable log: home
+// directories become ~ and the names of the files in personal folders are
+// replaced by a hash, the same name always giving the same hash.
+type redactHook struct {
+	enabled  atomic.Bool
+	salt     []byte
+	mu       sync.RWMutex
+	homes    []string
+	personal []string
+}
+
+var redactor = newRedactHook()
+
+func newRedactHook() *redactHook {
+	hook := &redactHook{}
+	hook.enabled.Store(config.Get().Log.Redact)
+	hook.salt, _ = os.ReadFile(machineIDFile)
+	if home, err := os.UserHomeDir(); err == nil {
+		hook.addHome(home)
+	}
+	if u, err := user.LookupId(strconv.Itoa(os.Getuid())); err == nil {
+		hook.addHome(u.HomeDir)
+	}
+	return hook
+}
+
+// SetRedaction switches the redaction of paths on or off, off being meant for
+// debugging.
+func SetRedaction(enabled bool) {
+	redactor.enabled.Store(enabled)
+}
+
+// AddPersonalFolders declares folders holding the user's files, e.g.
+// ~/Pictures. The names of the files below them are hashed in the log.
+func AddPersonalFolders(dirs ...string) {
+	redactor.mu.Lock()
+	defer redactor.mu.Unlock()
+	for _, dir := range dirs {
+		dir = filepath.Clean(dir)
+		if filepath.IsAbs(dir) && dir != "/" {
+			redactor.personal = append(redactor.personal, dir)
+		}
+	}
+}
+
+func (hook *redactHook) addHome(home string) {
+	home = filepath.Clean(home)
+	if filepath.IsAbs(home) && home != "/" {
+		hook.homes = append(hook.homes, home)
+	}
+}
+
+func (hook *redactHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (hook *redactHook) Fire(entry *logrus.Entry) error {
+	if !hook.enabled.Load() {
+		return nil
+	}
+	hook.mu.RLock()
+	defer hook.mu.RUnlock()
+	entry.Message = hook.redactString(entry.Message)
+	for k, v := range entry.Data {
+		entry.Data[k] = hook.redactValue(v)
+	}
+	return nil
+}
+
+// maxRedactDepth bounds the walk of nested values, which may be cyclic.
+const maxRedactDepth = 8
+
+// redactValue returns a redacted copy of the values the logger is given.
+// Maps, slices and structs are walked, a struct becoming the map of its
+// exported fields as the JSON formatter writes it. A fmt.Stringer holding a
+// path becomes its redacted string, the other types are left alone.
+func (hook *redactHook) redactValue(value interface{}) interface{} {
+	return hook.redactDepth(value, 0)
+}
+
+func (hook *redactHook) redactDepth(value interface{}, depth int) interface{} {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case string:
+		return hook.redactString(v)
+	case error:
+		return hook.redactString(v.Error())
+	case []string:
+		redacted := make([]string, len(v))
+		for i, s := range v {
+			redacted[i] = hook.redactString(s)
+		}
+		return redacted
+	case map[string]string:
+		redacted := make(map[string]string, len(v))
+		for k, s := range v {
+			redacted[hook.redactString(k)] = hook.redactString(s)
+		}
+		return redacted
+	case logrus.Fields:
+		redacted := make(logrus.Fields, len(v))
+		for k, e := range v {
+			redacted[k] = hook.redactDepth(e, depth+1)
+		}
+		return redacted
+	case []logrus.Fields:
+		redacted := make([]logrus.Fields, len(v))
+		for i, e := range v {
+			redacted[i] = hook.redactDepth(e, depth+1).(logrus.Fields)
+		}
+		return redacted
+	case []byte:
+		return value
+	case fmt.Stringer:
+		if s := v.String(); strings.Contains(s, "/") {
+			return hook.redactString(s)
+		}
+		return value
+	}
+	if depth >= maxRedactDepth {
+		return "..."
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if rv.IsNil() {
+			return value
+		}
+		return hook.redactDepth(rv.Elem().Interface(), depth+1)
+	case reflect.Map:
+		redacted := make(map[string]interface{}, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			key := hook.redactString(fmt.Sprint(iter.Key().Interface()))
+			redacted[key] = hook.redactDepth(iter.Value().Interface(), depth+1)
+		}
+		return redacted
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			return value
+		}
+		redacted := make([]interface{}, rv.Len())
+		for i := range redacted {
+			redacted[i] = hook.redactDepth(rv.Index(i).Interface(), depth+1)
+		}
+		return redacted
+	case reflect.Struct:
+		redacted := make(map[string]interface{}, rv.NumField())
+		rt := rv.Type()
+		for i := 0; i < rt.NumField(); i++ {
+			field := rt.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name := field.Name
+			if tag, _, _ := strings.Cut(field.Tag.Get("json"), ","); tag == "-" {
+				continue
+			} else if tag != "" {
+				name = tag
+			}
+			redacted[name] = hook.redactDepth(rv.Field(i).Interface(), depth+1)
+		}
+		return redacted
+	}
+	return value
+}
+
+// redactString redacts a value which is a path as a whole, spaces included,
+// or the paths found in a message.
+func (hook *redactHook) redactString(s string) string {
+	if !strings.Contains(s, "/") {
+		return s
+	}
+	if strings.HasPrefix(s, "/") && !strings.ContainsAny(s, "\n\"") && !strings.Contains(s, ": ") {
+		return hook.redactPath(s)
+	}
+	return pathPattern.ReplaceAllStringFunc(s, hook.redactPath)
+}
+
+// redactPath hashes the base name of a path in a personal folder, then
+// replaces the home directory by ~.
+func (hook *redactHook) redactPath(path string) string {
+	if hook.isPersonal(path) {
+		dir, name := filepath.Split(path)
+		path = dir + hook.hashName(name)
+	}
+	for _, home := range hook.homes {
+		if path == home || strings.HasPrefix(path, home+"/") {
+			return "~" + path[len(home):]
+		}
+	}
+	if loc := homePattern.FindStringIndex(path); loc != nil {
+		return "~" + path[loc[1]:]
+	}
+	return path
+}
+
+// isPersonal reports whether path is strictly below a personal folder. The
+// folders of the android shared storage, such as Pictures, are personal.
+func (hook *redactHook) isPersonal(path string) bool {
+	if strings.HasSuffix(path, "/") {
+		return false
+	}
+	if loc := media0Pattern.FindStringIndex(path); loc != nil && strings.Contains(path[loc[1]:], "/") {
+		return true
+	}
+	if strings.HasPrefix(path, androidStorage) && strings.Contains(path[len(androidStorage):], "/") {
+		return true
+	}
+	for _, dir := range hook.personal {
+		if strings.HasPrefix(path, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// hashName returns a short keyed hash of name, keeping its extension which
+// tells what kind of file is involved.
+func (hook *redactHook) hashName(name string) string {
+	ext := filepath.Ext(name)
+	if len(ext) > 8 || ext == name {
+		ext = ""
+	}
+	mac := hmac.New(sha256.New, hook.salt)
+	mac.Write([]byte(name))
+	return "#" + hex.EncodeToString(mac.Sum(nil)[:4]) + ext
+}
@@ -0,0 +1,78 @@
+package logger
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+type redactVolume struct {
+	Name   string
+	Path   string `json:"path"`
+	Size   int64
+	Hidden string `json:"-"`
+	owner  string
+}
+
+type redactStringer struct{ path string }
+
+func (s redactStringer) String() string { return "at " + s.path }
+
+func Test_redactHook(t *testing.T) {
+	hook := &redactHook{salt: []byte("machine")}
+	hook.enabled.Store(true)
+	hook.addHome("/srv/users/alice")
+	hook.personal = []string{"/srv/users/alice/Pictures"}
+	photo := hook.hashName("holiday.jpg")
+
+	tests := []struct {
+		value interface{}
+		want  interface{}
+	}{
+		{"/srv/users/alice", "~"},
+		{"/srv/users/alice/.config/fde", "~/.config/fde"},
+		{"/home/bob/Desktop/notes.txt", "~/Desktop/notes.txt"},
+		{"/var/lib/fde/volumes/sda1", "/var/lib/fde/volumes/sda1"},
+		{"/srv/users/alice/Pictures/holiday.jpg", "~/Pictures/" + photo},
+		{"/srv/users/alice/Pictures", "~/Pictures"},
+		{"/storage/emulated/0/DCIM/holiday.jpg", "/storage/emulated/0/DCIM/" + photo},
+		{"/home/bob/.local/share/openfde14/media/0/Pictures/holiday.jpg", "~/.local/share/openfde14/media/0/Pictures/" + photo},
+		{errors.New("open /srv/users/alice/Pictures/holiday.jpg: permission denied"), "open ~/Pictures/" + photo + ": permission denied"},
+		{[]string{"-o", "/home/bob/Pictures"}, []string{"-o", "~/Pictures"}},
+		{[]logrus.Fields{{"err": "stat /home/bob: no such file"}}, []logrus.Fields{{"err": "stat ~: no such file"}}},
+		{42, 42},
+		{map[string]interface{}{"source": "/srv/users/alice/Pictures/holiday.jpg", "density": 240},
+			map[string]interface{}{"source": "~/Pictures/" + photo, "density": 240}},
+		{redactVolume{Name: "sda1", Path: "/home/bob/disk", Size: 7, Hidden: "/home/bob/x", owner: "/home/bob"},
+			map[string]interface{}{"Name": "sda1", "path": "~/disk", "Size": int64(7)}},
+		{&redactVolume{Path: "/srv/users/alice/Pictures/holiday.jpg"},
+			map[string]interface{}{"Name": "", "path": "~/Pictures/" + photo, "Size": int64(0)}},
+		{redactStringer{"/home/bob/notes.txt"}, "at ~/notes.txt"},
+		{[]interface{}{"/home/bob", 1}, []interface{}{"~", 1}},
+		{[]redactVolume{{Path: "/home/bob"}}, []interface{}{map[string]interface{}{"Name": "", "path": "~", "Size": int64(0)}}},
+		{map[int][]string{1: {"/home/bob"}}, map[string]interface{}{"1": []string{"~"}}},
+	}
+	for _, tt := range tests {
+		entry := &logrus.Entry{Data: logrus.Fields{"path": tt.value}}
+		if err := hook.Fire(entry); err != nil {
+			t.Fatal(err)
+		}
+		if got := entry.Data["path"]; !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("redact(%+v) = %#v, want %#v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func Test_redactHookDisabled(t *testing.T) {
+	hook := &redactHook{}
+	hook.addHome("/home/alice")
+	entry := &logrus.Entry{Message: "/home/alice/x", Data: logrus.Fields{}}
+	if err := hook.Fire(entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.Message != "/home/alice/x" {
+		t.Errorf("disabled hook redacted %q", entry.Message)
+	}
+}
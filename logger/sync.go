@@ -0,0 +1,112 @@
+package logger
+
+import (
+	"fde_fs/config"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/warlice/lumberjack"
+)
+
+// errors are rare and the last ones before a crash matter most
+const defaultSync = "error"
+
+// syncPolicy tells when the log file is committed to disk.
+type syncPolicy struct {
+	onError  bool
+	every    int
+	interval time.Duration
+}
+
+// parseSyncPolicy reads a comma separated list of "never", "error" (after each
+// line at error level or above), a number of writes or a duration, e.g.
+// "error,5s".
+func parseSyncPolicy(value string) syncPolicy {
+	var policy syncPolicy
+	for _, item := range strings.Split(value, ",") {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if item == "" {
+			continue
+		}
+		if item == "never" {
+			return syncPolicy{}
+		}
+		if item == "error" {
+			policy.onError = true
+		} else if n, err := strconv.Atoi(item); err == nil && n > 0 {
+			policy.every = n
+		} else if d, err := time.ParseDuration(item); err == nil && d > 0 {
+			policy.interval = d
+		}
+	}
+	return policy
+}
+
+// logSyncPolicy returns the policy of log.sync.
+func logSyncPolicy() syncPolicy {
+	value := config.Get().Log.Sync
+	if value == "" {
+		value = defaultSync
+	}
+	return parseSyncPolicy(value)
+}
+
+// apply sets the write count and interval part of the policy on l.
+func (policy syncPolicy) apply(l *lumberjack.Logger) {
+	l.SyncEvery = policy.every
+	l.SyncInterval = policy.interval
+}
+
+// Sync commits the log file to disk, e.g. before unmounting or suspending.
+func Sync() {
+	if LumberLogger == nil {
+		return
+	}
+	if err := LumberLogger.Sync(); err != nil {
+		Logger.WithError(err).Warn("log_sync_failed")
+	}
+}
+
+// syncWriter syncs the log file after writing a line flagged by
+// errorSyncFormatter.
+type syncWriter struct {
+	io.Writer
+	l        *lumberjack.Logger
+	syncNext bool
+}
+
+func (w *syncWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	if w.syncNext {
+		w.syncNext = false
+		if errSync := w.l.Sync(); err == nil {
+			err = errSync
+		}
+	}
+	return n, err
+}
+
+// errorSyncFormatter flags the lines at error level or above for syncWriter.
+// Unlike hooks, which fire before the line is written, the formatter and the
+// writer run one after the other under the lock of the logrus logger.
+type errorSyncFormatter struct {
+	logrus.Formatter
+	w *syncWriter
+}
+
+func (f *errorSyncFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	if entry.Level <= logrus.ErrorLevel {
+		f.w.syncNext = true
+	}
+	return f.Formatter.Format(entry)
+}
+
+// syncOnError makes logger sync l after each line at error level or above.
+func (logger *StandardLogger) syncOnError(l *lumberjack.Logger) {
+	w := &syncWriter{Writer: logger.Out, l: l}
+	logger.SetOutput(w)
+	logger.Formatter = &errorSyncFormatter{Formatter: logger.Formatter, w: w}
+}
@@ -0,0 +1,26 @@
+package logger
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_parseSyncPolicy(t *testing.T) {
+	tests := []struct {
+		value string
+		want  syncPolicy
+	}{
+		{"", syncPolicy{}},
+		{"never", syncPolicy{}},
+		{"error", syncPolicy{onError: true}},
+		{"Error, 5s", syncPolicy{onError: true, interval: 5 * time.Second}},
+		{"10", syncPolicy{every: 10}},
+		{"error,never", syncPolicy{}},
+		{"-1,0s,sometimes", syncPolicy{}},
+	}
+	for _, tt := range tests {
+		if got := parseSyncPolicy(tt.value); got != tt.want {
+			t.Errorf("parseSyncPolicy(%q) = %+v, want %+v", tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package logger
+
+import (
+	"log/syslog"
+	"os"
+	"path/filepath"
+
+	"github.com/sirupsen/logrus"
+)
+
+// syslogHook writes every entry to the local syslog daemon through /dev/log.
+type syslogHook struct {
+	writer    *syslog.Writer
+	formatter logrus.Formatter
+}
+
+func newSyslogHook() (*syslogHook, error) {
+	writer, err := syslog.Dial("unixgram", "/dev/log", syslog.LOG_DAEMON|syslog.LOG_INFO, filepath.Base(os.Args[0]))
+	if err != nil {
+		return nil, err
+	}
+	return &syslogHook{
+		writer: writer,
+		// syslog stamps the time itself
+		formatter: &logrus.TextFormatter{DisableTimestamp: true, DisableColors: true},
+	}, nil
+}
+
+func (hook *syslogHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (hook *syslogHook) Fire(entry *logrus.Entry) error {
+	line, err := hook.formatter.Format(entry)
+	if err != nil {
+		return err
+	}
+	msg := string(line)
+	switch entry.Level {
+	case logrus.PanicLevel, logrus.FatalLevel:
+		return hook.writer.Crit(msg)
+	case logrus.ErrorLevel:
+		return hook.writer.Err(msg)
+	case logrus.WarnLevel:
+		return hook.writer.Warning(msg)
+	case logrus.InfoLevel:
+		return hook.writer.Info(msg)
+	default:
+		return hook.writer.Debug(msg)
+	}
+}
@@ -1,7 +1,10 @@
 package lumberjack
 
 import (
+	"fmt"
 	"os"
+	"os/user"
+	"strconv"
 	"syscall"
 )
 
@@ -17,3 +20,50 @@ func chown(name string, info os.FileInfo) error {
 	stat := info.Sys().(*syscall.Stat_t)
 	return osChown(name, int(stat.Uid), int(stat.Gid))
 }
+
+// applyOwner gives name to Owner and Group, if set.
+func (l *Logger) applyOwner(name string) error {
+	if l.Owner == "" && l.Group == "" {
+		return nil
+	}
+	uid, gid := -1, -1
+	if l.Owner != "" {
+		id, err := lookupID(l.Owner, func(name string) (string, error) {
+			u, err := user.Lookup(name)
+			if err != nil {
+				return "", err
+			}
+			return u.Uid, nil
+		})
+		if err != nil {
+			return fmt.Errorf("unknown log file owner %q: %v", l.Owner, err)
+		}
+		uid = id
+	}
+	if l.Group != "" {
+		id, err := lookupID(l.Group, func(name string) (string, error) {
+			g, err := user.LookupGroup(name)
+			if err != nil {
+				return "", err
+			}
+			return g.Gid, nil
+		})
+		if err != nil {
+			return fmt.Errorf("unknown log file group %q: %v", l.Group, err)
+		}
+		gid = id
+	}
+	return osChown(name, uid, gid)
+}
+
+// lookupID returns the numeric id of name, which may already be one.
+func lookupID(name string, lookup func(string) (string, error)) (int, error) {
+	if id, err := strconv.Atoi(name); err == nil {
+		return id, nil
+	}
+	idStr, err := lookup(name)
+	if err != nil {
+		return -1, err
+	}
+	return strconv.Atoi(idStr)
+}
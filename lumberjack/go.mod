@@ -1,3 +1,5 @@
 module github.com/warlice/lumberjack
 
 go 1.24.10
+
+require github.com/klauspost/compress v1.18.0
@@ -175,6 +175,83 @@ func TestCompressMaintainOwner(t *testing.T) {
 	equals(666, fakeFS.files[filename2+compressSuffix].gid, t)
 }
 
+func TestFileModeAndOwner(t *testing.T) {
+	fakeFS := newFakeFS()
+	osChown = fakeFS.Chown
+	osStat = fakeFS.Stat
+	defer func() {
+		osChown = os.Chown
+		osStat = os.Stat
+	}()
+	currentTime = fakeTime
+	dir := makeTempDir("TestFileModeAndOwner", t)
+	defer os.RemoveAll(dir)
+
+	filename := logFile(dir)
+
+	// a world writable log file left by an older version.
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_RDWR, 0666)
+	isNil(err, t)
+	f.Close()
+	isNil(os.Chmod(filename, 0666), t)
+
+	mode := os.FileMode(0640)
+	l := &Logger{
+		Compress:   true,
+		Filename:   filename,
+		MaxBackups: 1,
+		MaxSize:    100, // megabytes
+		FileMode:   mode,
+		Owner:      "1234",
+		Group:      "4321",
+	}
+	defer l.Close()
+	b := []byte("boo!")
+	n, err := l.Write(b)
+	isNil(err, t)
+	equals(len(b), n, t)
+
+	info, err := os.Stat(filename)
+	isNil(err, t)
+	equals(mode, info.Mode(), t)
+
+	newFakeTime()
+
+	err = l.Rotate()
+	isNil(err, t)
+
+	// we need to wait a little bit since the files get compressed on a different
+	// goroutine.
+	<-time.After(10 * time.Millisecond)
+
+	filename2 := backupFile(dir) + compressSuffix
+	info, err = os.Stat(filename)
+	isNil(err, t)
+	info2, err := os.Stat(filename2)
+	isNil(err, t)
+	equals(mode, info.Mode(), t)
+	equals(mode, info2.Mode(), t)
+
+	equals(1234, fakeFS.files[filename].uid, t)
+	equals(4321, fakeFS.files[filename].gid, t)
+	equals(1234, fakeFS.files[filename2].uid, t)
+	equals(4321, fakeFS.files[filename2].gid, t)
+}
+
+func TestUnknownOwner(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestUnknownOwner", t)
+	defer os.RemoveAll(dir)
+
+	l := &Logger{
+		Filename: logFile(dir),
+		Owner:    "no-such-user-lumberjack",
+	}
+	defer l.Close()
+	_, err := l.Write([]byte("boo!"))
+	notNil(err, t)
+}
+
 type fakeFile struct {
 	uid int
 	gid int
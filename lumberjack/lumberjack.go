@@ -3,7 +3,7 @@
 // Note that this is v2.0 of lumberjack, and should be imported using gopkg.in
 // thusly:
 //
-//   import "gopkg.in/natefinch/lumberjack.v2"
+//	import "gopkg.in/natefinch/lumberjack.v2"
 //
 // The package name remains simply lumberjack, and the code resides at
 // https://github.com/natefinch/lumberjack under the v2.0 branch.
@@ -30,14 +30,18 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/klauspost/compress/zstd"
 )
 
 const (
 	backupTimeFormat = "2006-01-02T15-04-05.000"
 	compressSuffix   = ".gz"
+	zstdSuffix       = ".zst"
 	defaultMaxSize   = 100
 )
 
@@ -66,7 +70,7 @@ var _ io.WriteCloser = (*Logger)(nil)
 // `/var/log/foo/server.log`, a backup created at 6:30pm on Nov 11 2016 would
 // use the filename `/var/log/foo/server-2016-11-04T18-30-00.000.log`
 //
-// Cleaning Up Old Log Files
+// # Cleaning Up Old Log Files
 //
 // Whenever a new logfile gets created, old log files may be deleted.  The most
 // recent files according to the encoded timestamp will be retained, up to a
@@ -75,7 +79,21 @@ var _ io.WriteCloser = (*Logger)(nil)
 // MaxBackups.  Note that the time encoded in the timestamp is the rotation
 // time, which may differ from the last time that file was written to.
 //
-// If MaxBackups and MaxAge are both 0, no old log files will be deleted.
+// If MaxTotalSize is set, the oldest backups are then deleted until the
+// current log file and the remaining backups, compressed or not, take at most
+// MaxTotalSize megabytes.
+//
+// If MaxBackups, MaxAge and MaxTotalSize are all 0, no old log files will be
+// deleted.
+//
+// # Time Based Rotation
+//
+// If RotationInterval is set, the log file is also rotated when an interval
+// boundary is crossed, e.g. every midnight for 24 hours.  Boundaries are
+// aligned on midnight, in local time if LocalTime is set and UTC otherwise.
+// Such backups are named after the start of the interval they cover rather
+// than the rotation time, so the log of Nov 11 2016 rotated daily is
+// `/var/log/foo/server-2016-11-11T00-00-00.000.log`.
 type Logger struct {
 	// Filename is the file to write logs to.  Backup log files will be retained
 	// in the same directory.  It uses <processname>-lumberjack.log in
@@ -98,6 +116,11 @@ type Logger struct {
 	// deleted.)
 	MaxBackups int `json:"maxbackups" yaml:"maxbackups"`
 
+	// MaxTotalSize is the maximum size in megabytes of the log file and its
+	// backups together.  The oldest backups are removed to stay below it, the
+	// current log file never is.  The default is no limit.
+	MaxTotalSize int `json:"maxtotalsize" yaml:"maxtotalsize"`
+
 	// LocalTime determines if the time used for formatting the timestamps in
 	// backup files is the computer's local time.  The default is to use UTC
 	// time.
@@ -107,12 +130,73 @@ type Logger struct {
 	// using gzip. The default is not to perform compression.
 	Compress bool `json:"compress" yaml:"compress"`
 
+	// Compression selects the compression of rotated log files and enables
+	// it: "gzip" or "zstd", optionally followed by a level, e.g. "gzip:9" or
+	// "zstd:3".  gzip levels go from 1 (fastest) to 9 (best), zstd levels
+	// from 1 (fastest) to 4 (best).  "none" disables compression even if
+	// Compress is set, an unknown value falls back to gzip.  Backups
+	// compressed either way are recognized, so switching keeps old ones.
+	Compression string `json:"compression" yaml:"compression"`
+
+	// FileMode is the permission of the log file and of its backups,
+	// compressed or not, regardless of the umask.  The default is to keep
+	// the mode of the old log file, or 0666 minus the umask for a new one.
+	FileMode os.FileMode `json:"filemode" yaml:"filemode"`
+
+	// Owner and Group own the log file and its backups, given by name or
+	// numeric id.  The default is to keep the owner of the old log file.
+	// Only supported on linux.
+	Owner string `json:"owner" yaml:"owner"`
+	Group string `json:"group" yaml:"group"`
+
+	// OnRotate is called with the path of each new backup once it has been
+	// renamed and, if enabled, compressed, e.g. to ship it to a collector.
+	// It runs on the goroutine compressing and removing old log files, so it
+	// never blocks Write, but delays the handling of the next rotations.  A
+	// backup removed before being handed over, because of MaxBackups for
+	// instance, is skipped.
+	OnRotate func(backupPath string) `json:"-" yaml:"-"`
+
+	// BackupLink is the path of a symlink kept pointing at the most recent
+	// backup, relative to the log file directory unless absolute.  It is
+	// updated along with OnRotate.  The default is not to keep a link.
+	BackupLink string `json:"backuplink" yaml:"backuplink"`
+
+	// SyncEvery makes Write sync the log file to disk every SyncEvery
+	// writes, 1 syncing each of them.  SyncInterval makes Write sync it at
+	// most SyncInterval after a write.  With either set, the log file is
+	// also synced before being rotated or closed.  The default is never to
+	// sync, leaving it to the kernel, see Sync to sync on demand.
+	SyncEvery    int           `json:"syncevery" yaml:"syncevery"`
+	SyncInterval time.Duration `json:"syncinterval" yaml:"syncinterval"`
+
+	// RotationInterval is how often the log file is rotated regardless of its
+	// size, checked on each Write and by a timer.  It should divide a day,
+	// such as time.Hour, or be a whole number of days.  The default is to
+	// rotate on size only.
+	RotationInterval time.Duration `json:"rotationinterval" yaml:"rotationinterval"`
+
 	size int64
 	file *os.File
 	mu   sync.Mutex
 
+	// periodStart is the start of the interval the current file belongs to,
+	// nextRotation the end of it.
+	periodStart  time.Time
+	nextRotation time.Time
+	timer        *time.Timer
+
+	// unsynced counts the writes since the last sync.
+	unsynced  int
+	syncTimer *time.Timer
+
 	millCh    chan bool
 	startMill sync.Once
+
+	// rotated lists the backups not handed over to OnRotate and BackupLink
+	// yet.  It has its own lock as the mill goroutine takes it.
+	rotated   []string
+	rotatedMu sync.Mutex
 }
 
 var (
@@ -149,6 +233,12 @@ func (l *Logger) Write(p []byte) (n int, err error) {
 		}
 	}
 
+	if l.intervalElapsed() {
+		if err := l.rotateInterval(); err != nil {
+			return 0, err
+		}
+	}
+
 	if l.size+writeLen > l.max() {
 		if err := l.rotate(); err != nil {
 			return 0, err
@@ -158,9 +248,63 @@ func (l *Logger) Write(p []byte) (n int, err error) {
 	n, err = l.file.Write(p)
 	l.size += int64(n)
 
+	if n > 0 {
+		l.unsynced++
+		switch {
+		case l.SyncEvery > 0 && l.unsynced >= l.SyncEvery:
+			if errSync := l.sync(); err == nil {
+				err = errSync
+			}
+		case l.SyncInterval > 0 && l.syncTimer == nil:
+			l.syncTimer = time.AfterFunc(l.SyncInterval, l.syncOnTimer)
+		}
+	}
+
 	return n, err
 }
 
+// Sync commits the log file to disk.  If this Logger has not opened the log
+// file, the file on disk is synced anyway, so that a process can flush what
+// another one wrote.
+func (l *Logger) Sync() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		f, err := os.Open(l.filename())
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("can't open log file to sync: %s", err)
+		}
+		defer f.Close()
+		return f.Sync()
+	}
+	return l.sync()
+}
+
+// sync commits the log file to disk if it was written since the last sync.
+func (l *Logger) sync() error {
+	if l.syncTimer != nil {
+		l.syncTimer.Stop()
+		l.syncTimer = nil
+	}
+	if l.file == nil || l.unsynced == 0 {
+		return nil
+	}
+	l.unsynced = 0
+	return l.file.Sync()
+}
+
+// syncOnTimer syncs the log file SyncInterval after a write.
+func (l *Logger) syncOnTimer() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.syncTimer = nil
+	// what am I going to do, log this?
+	_ = l.sync()
+}
+
 // Close implements io.Closer, and closes the current logfile.
 func (l *Logger) Close() error {
 	l.mu.Lock()
@@ -170,11 +314,22 @@ func (l *Logger) Close() error {
 
 // close closes the file if it is open.
 func (l *Logger) close() error {
+	if l.timer != nil {
+		l.timer.Stop()
+		l.timer = nil
+	}
 	if l.file == nil {
 		return nil
 	}
-	err := l.file.Close()
+	var err error
+	if l.SyncEvery > 0 || l.SyncInterval > 0 {
+		err = l.sync()
+	}
+	if errClose := l.file.Close(); err == nil {
+		err = errClose
+	}
 	l.file = nil
+	l.unsynced = 0
 	return err
 }
 
@@ -193,10 +348,42 @@ func (l *Logger) Rotate() error {
 // (if it exists), opens a new file with the original filename, and then runs
 // post-rotation processing and removal.
 func (l *Logger) rotate() error {
+	return l.rotateAs(time.Time{})
+}
+
+// rotateInterval rotates the log file at the end of its interval, naming the
+// backup after the start of the interval.  When another process writing the
+// same file rotated it already, the new file is opened instead.
+func (l *Logger) rotateInterval() error {
+	if l.rotatedElsewhere() {
+		if err := l.close(); err != nil {
+			return err
+		}
+		return l.openExistingOrNew(0)
+	}
+	return l.rotateAs(l.periodStart)
+}
+
+// rotatedElsewhere reports whether the open file is no longer the one at
+// Filename, moved away or removed by someone else.
+func (l *Logger) rotatedElsewhere() bool {
+	if l.file == nil {
+		return false
+	}
+	open, err := l.file.Stat()
+	if err != nil {
+		return false
+	}
+	current, err := os.Stat(l.filename())
+	return err != nil || !os.SameFile(open, current)
+}
+
+// rotateAs is rotate, naming the backup after backupTime unless it is zero.
+func (l *Logger) rotateAs(backupTime time.Time) error {
 	if err := l.close(); err != nil {
 		return err
 	}
-	if err := l.openNew(); err != nil {
+	if err := l.openNewAs(backupTime); err != nil {
 		return err
 	}
 	l.mill()
@@ -206,6 +393,12 @@ func (l *Logger) rotate() error {
 // openNew opens a new log file for writing, moving any old log file out of the
 // way.  This methods assumes the file has already been closed.
 func (l *Logger) openNew() error {
+	return l.openNewAs(time.Time{})
+}
+
+// openNewAs is openNew, naming the backup of the old log file after
+// backupTime unless it is zero or such a backup already exists.
+func (l *Logger) openNewAs(backupTime time.Time) error {
 	err := os.MkdirAll(l.dir(), 0755)
 	if err != nil {
 		return fmt.Errorf("can't make directories for new logfile: %s", err)
@@ -219,9 +412,23 @@ func (l *Logger) openNew() error {
 		mode = info.Mode()
 		// move the existing file
 		newname := backupName(name, l.LocalTime)
+		if !backupTime.IsZero() {
+			aligned := backupNameAt(name, backupTime, l.LocalTime)
+			if _, err := osStat(aligned); os.IsNotExist(err) {
+				newname = aligned
+			}
+		}
 		if err := os.Rename(name, newname); err != nil {
 			return fmt.Errorf("can't rename log file: %s", err)
 		}
+		if err := l.applyFileOptions(newname); err != nil {
+			return err
+		}
+		if l.OnRotate != nil || l.BackupLink != "" {
+			l.rotatedMu.Lock()
+			l.rotated = append(l.rotated, newname)
+			l.rotatedMu.Unlock()
+		}
 
 		// this is a no-op anywhere but linux
 		if err := chown(name, info); err != nil {
@@ -236,8 +443,13 @@ func (l *Logger) openNew() error {
 	if err != nil {
 		return fmt.Errorf("can't open new logfile: %s", err)
 	}
+	if err := l.applyFileOptions(name); err != nil {
+		f.Close()
+		return err
+	}
 	l.file = f
 	l.size = 0
+	l.startInterval(currentTime())
 	return nil
 }
 
@@ -245,11 +457,15 @@ func (l *Logger) openNew() error {
 // between the filename and the extension, using the local time if requested
 // (otherwise UTC).
 func backupName(name string, local bool) string {
+	return backupNameAt(name, currentTime(), local)
+}
+
+// backupNameAt is backupName with the timestamp of t.
+func backupNameAt(name string, t time.Time, local bool) string {
 	dir := filepath.Dir(name)
 	filename := filepath.Base(name)
 	ext := filepath.Ext(filename)
 	prefix := filename[:len(filename)-len(ext)]
-	t := currentTime()
 	if !local {
 		t = t.UTC()
 	}
@@ -277,14 +493,110 @@ func (l *Logger) openExistingOrNew(writeLen int) error {
 		return l.rotate()
 	}
 
+	// a file left by a previous run in an earlier interval is rotated right
+	// away, named after the interval it was last written in.
+	if l.RotationInterval > 0 && info.Size() > 0 {
+		if start := l.intervalStart(info.ModTime()); start.Before(l.intervalStart(currentTime())) {
+			return l.rotateAs(start)
+		}
+	}
+
 	file, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0644)
 	if err != nil {
 		// if we fail to open the old log file for some reason, just ignore
 		// it and open a new log file.
 		return l.openNew()
 	}
+	if err := l.applyFileOptions(filename); err != nil {
+		file.Close()
+		return err
+	}
 	l.file = file
 	l.size = info.Size()
+	l.startInterval(currentTime())
+	return nil
+}
+
+// intervalStart returns the start of the rotation interval t falls in.
+// Intervals are aligned on midnight, those of a day or more start at the
+// midnight of t.
+func (l *Logger) intervalStart(t time.Time) time.Time {
+	if !l.LocalTime {
+		t = t.UTC()
+	}
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	if l.RotationInterval >= 24*time.Hour {
+		return midnight
+	}
+	return midnight.Add(t.Sub(midnight).Truncate(l.RotationInterval))
+}
+
+// intervalEnd returns the end of the rotation interval starting at start,
+// never past the next midnight for intervals shorter than a day.
+func (l *Logger) intervalEnd(start time.Time) time.Time {
+	midnight := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, start.Location())
+	if l.RotationInterval >= 24*time.Hour {
+		return midnight.AddDate(0, 0, int(l.RotationInterval/(24*time.Hour)))
+	}
+	end := start.Add(l.RotationInterval)
+	if next := midnight.AddDate(0, 0, 1); end.After(next) {
+		return next
+	}
+	return end
+}
+
+// startInterval records the interval the current file belongs to and arms
+// the timer rotating it at the end of the interval.
+func (l *Logger) startInterval(now time.Time) {
+	if l.RotationInterval <= 0 {
+		return
+	}
+	l.periodStart = l.intervalStart(now)
+	l.nextRotation = l.intervalEnd(l.periodStart)
+	if l.timer != nil {
+		l.timer.Stop()
+	}
+	l.timer = time.AfterFunc(l.nextRotation.Sub(now), l.rotateOnTimer)
+}
+
+// intervalElapsed reports whether the current file has reached the end of its
+// rotation interval.
+func (l *Logger) intervalElapsed() bool {
+	return l.RotationInterval > 0 && !l.nextRotation.IsZero() && !currentTime().Before(l.nextRotation)
+}
+
+// rotateOnTimer rotates the log file at the end of its interval when nothing
+// was written since.  An empty file is kept and only starts a new interval.
+func (l *Logger) rotateOnTimer() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return
+	}
+	now := currentTime()
+	if now.Before(l.nextRotation) {
+		// fired early, e.g. after the clock was set back
+		l.startInterval(now)
+		return
+	}
+	if l.size == 0 {
+		l.startInterval(now)
+		return
+	}
+	// what am I going to do, log this?
+	_ = l.rotateInterval()
+}
+
+// applyFileOptions sets FileMode, Owner and Group on name, those which are set.
+func (l *Logger) applyFileOptions(name string) error {
+	if l.FileMode != 0 {
+		if err := os.Chmod(name, l.FileMode.Perm()); err != nil {
+			return fmt.Errorf("can't set log file mode: %s", err)
+		}
+	}
+	if err := l.applyOwner(name); err != nil {
+		return fmt.Errorf("can't set log file owner: %s", err)
+	}
 	return nil
 }
 
@@ -300,9 +612,10 @@ func (l *Logger) filename() string {
 // millRunOnce performs compression and removal of stale log files.
 // Log files are compressed if enabled via configuration and old log
 // files are removed, keeping at most l.MaxBackups files, as long as
-// none of them are older than MaxAge.
+// none of them are older than MaxAge and they fit in MaxTotalSize.
 func (l *Logger) millRunOnce() error {
-	if l.MaxBackups == 0 && l.MaxAge == 0 && !l.Compress {
+	codec := l.codec()
+	if l.MaxBackups == 0 && l.MaxAge == 0 && l.MaxTotalSize == 0 && codec == nil {
 		return nil
 	}
 
@@ -319,11 +632,7 @@ func (l *Logger) millRunOnce() error {
 		for _, f := range files {
 			// Only count the uncompressed log file or the
 			// compressed log file, not both.
-			fn := f.Name()
-			if strings.HasSuffix(fn, compressSuffix) {
-				fn = fn[:len(fn)-len(compressSuffix)]
-			}
-			preserved[fn] = true
+			preserved[trimCompressedSuffix(f.Name())] = true
 
 			if len(preserved) > l.MaxBackups {
 				remove = append(remove, f)
@@ -347,10 +656,30 @@ func (l *Logger) millRunOnce() error {
 		}
 		files = remaining
 	}
+	if l.MaxTotalSize > 0 {
+		budget := int64(l.MaxTotalSize) * int64(megabyte)
+		// the current log file is part of the budget but is never removed
+		total := int64(0)
+		if info, err := osStat(l.filename()); err == nil {
+			total = info.Size()
+		}
+
+		var remaining []logInfo
+		for _, f := range files {
+			// files are sorted newest first, keep them while they fit
+			total += f.Size()
+			if total > budget {
+				remove = append(remove, f)
+			} else {
+				remaining = append(remaining, f)
+			}
+		}
+		files = remaining
+	}
 
-	if l.Compress {
+	if codec != nil {
 		for _, f := range files {
-			if !strings.HasSuffix(f.Name(), compressSuffix) {
+			if trimCompressedSuffix(f.Name()) == f.Name() {
 				compress = append(compress, f)
 			}
 		}
@@ -364,7 +693,10 @@ func (l *Logger) millRunOnce() error {
 	}
 	for _, f := range compress {
 		fn := filepath.Join(l.dir(), f.Name())
-		errCompress := compressLogFile(fn, fn+compressSuffix)
+		errCompress := compressLogFile(fn, fn+codec.suffix, codec)
+		if errCompress == nil {
+			errCompress = l.applyFileOptions(fn + codec.suffix)
+		}
 		if err == nil && errCompress != nil {
 			err = errCompress
 		}
@@ -377,11 +709,81 @@ func (l *Logger) millRunOnce() error {
 // of old log files.
 func (l *Logger) millRun() {
 	for range l.millCh {
+		// backups rotated meanwhile are handed over on the next run, once
+		// compressed.
+		l.rotatedMu.Lock()
+		rotated := l.rotated
+		l.rotated = nil
+		l.rotatedMu.Unlock()
+
 		// what am I going to do, log this?
 		_ = l.millRunOnce()
+		_ = l.handOverRotated(rotated)
 	}
 }
 
+// handOverRotated points BackupLink at the most recent of the rotated backups
+// and passes them to OnRotate, under the name they have after compression.
+func (l *Logger) handOverRotated(rotated []string) error {
+	var backups []string
+	for _, name := range rotated {
+		if path, ok := backupPath(name); ok {
+			backups = append(backups, path)
+		}
+	}
+	if len(backups) == 0 {
+		return nil
+	}
+
+	var err error
+	if l.BackupLink != "" {
+		err = l.updateBackupLink(backups[len(backups)-1])
+	}
+	if l.OnRotate != nil {
+		for _, path := range backups {
+			l.OnRotate(path)
+		}
+	}
+	return err
+}
+
+// backupPath returns where the backup renamed to name is now, possibly with a
+// compressed suffix, and false if it is gone.
+func backupPath(name string) (string, bool) {
+	if _, err := os.Lstat(name); err == nil {
+		return name, true
+	}
+	for _, suffix := range compressedSuffixes {
+		if _, err := os.Lstat(name + suffix); err == nil {
+			return name + suffix, true
+		}
+	}
+	return "", false
+}
+
+// updateBackupLink replaces BackupLink by a symlink to backup.  The link is
+// renamed into place so readers never miss it.
+func (l *Logger) updateBackupLink(backup string) error {
+	link := l.BackupLink
+	if !filepath.IsAbs(link) {
+		link = filepath.Join(l.dir(), link)
+	}
+	target := backup
+	if filepath.Dir(link) == filepath.Dir(backup) {
+		target = filepath.Base(backup)
+	}
+	tmp := link + ".tmp"
+	os.Remove(tmp)
+	if err := os.Symlink(target, tmp); err != nil {
+		return fmt.Errorf("can't create backup link: %s", err)
+	}
+	if err := os.Rename(tmp, link); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("can't rename backup link: %s", err)
+	}
+	return nil
+}
+
 // mill performs post-rotation compression and removal of stale log files,
 // starting the mill goroutine if necessary.
 func (l *Logger) mill() {
@@ -414,10 +816,6 @@ func (l *Logger) oldLogFiles() ([]logInfo, error) {
 			logFiles = append(logFiles, logInfo{t, f})
 			continue
 		}
-		if t, err := l.timeFromName(f.Name(), prefix, ext+compressSuffix); err == nil {
-			logFiles = append(logFiles, logInfo{t, f})
-			continue
-		}
 		// error parsing means that the suffix at the end was not generated
 		// by lumberjack, and therefore it's not a backup file.
 	}
@@ -428,12 +826,13 @@ func (l *Logger) oldLogFiles() ([]logInfo, error) {
 }
 
 // timeFromName extracts the formatted time from the filename by stripping off
-// the filename's prefix and extension. This prevents someone's filename from
-// confusing time.parse.
+// the filename's prefix and extension, along with the suffix of a compressed
+// backup. This prevents someone's filename from confusing time.parse.
 func (l *Logger) timeFromName(filename, prefix, ext string) (time.Time, error) {
 	if !strings.HasPrefix(filename, prefix) {
 		return time.Time{}, errors.New("mismatched prefix")
 	}
+	filename = trimCompressedSuffix(filename)
 	if !strings.HasSuffix(filename, ext) {
 		return time.Time{}, errors.New("mismatched extension")
 	}
@@ -463,9 +862,69 @@ func (l *Logger) prefixAndExt() (prefix, ext string) {
 	return prefix, ext
 }
 
-// compressLogFile compresses the given log file, removing the
+// codec compresses rotated log files into files ending in suffix.
+type codec struct {
+	suffix    string
+	newWriter func(w io.Writer) (io.WriteCloser, error)
+}
+
+// compressedSuffixes lists the suffixes of all the codecs, so backups
+// compressed with an earlier setting are still recognized.
+var compressedSuffixes = []string{compressSuffix, zstdSuffix}
+
+// trimCompressedSuffix returns name without its compressed suffix, if any.
+func trimCompressedSuffix(name string) string {
+	for _, suffix := range compressedSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return name[:len(name)-len(suffix)]
+		}
+	}
+	return name
+}
+
+// codec returns the compression of rotated log files, nil if they are kept
+// uncompressed.
+func (l *Logger) codec() *codec {
+	name, levelStr, hasLevel := strings.Cut(strings.ToLower(strings.TrimSpace(l.Compression)), ":")
+	if name == "" {
+		if !l.Compress {
+			return nil
+		}
+		name = "gzip"
+	}
+	level, err := strconv.Atoi(levelStr)
+	if !hasLevel || err != nil {
+		level = 0
+	}
+	switch name {
+	case "none", "off":
+		return nil
+	case "zstd":
+		if level < int(zstd.SpeedFastest) || level > int(zstd.SpeedBestCompression) {
+			level = int(zstd.SpeedDefault)
+		}
+		return &codec{
+			suffix: zstdSuffix,
+			newWriter: func(w io.Writer) (io.WriteCloser, error) {
+				return zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.EncoderLevel(level)))
+			},
+		}
+	default:
+		if level < gzip.BestSpeed || level > gzip.BestCompression {
+			level = gzip.DefaultCompression
+		}
+		return &codec{
+			suffix: compressSuffix,
+			newWriter: func(w io.Writer) (io.WriteCloser, error) {
+				return gzip.NewWriterLevel(w, level)
+			},
+		}
+	}
+}
+
+// compressLogFile compresses the given log file with c, removing the
 // uncompressed log file if successful.
-func compressLogFile(src, dst string) (err error) {
+func compressLogFile(src, dst string, c *codec) (err error) {
 	f, err := os.Open(src)
 	if err != nil {
 		return fmt.Errorf("failed to open log file: %v", err)
@@ -489,8 +948,6 @@ func compressLogFile(src, dst string) (err error) {
 	}
 	defer gzf.Close()
 
-	gz := gzip.NewWriter(gzf)
-
 	defer func() {
 		if err != nil {
 			os.Remove(dst)
@@ -498,6 +955,10 @@ func compressLogFile(src, dst string) (err error) {
 		}
 	}()
 
+	gz, err := c.newWriter(gzf)
+	if err != nil {
+		return err
+	}
 	if _, err := io.Copy(gz, f); err != nil {
 		return err
 	}
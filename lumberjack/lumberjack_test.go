@@ -10,6 +10,8 @@ import (
 	"path/filepath"
 	"testing"
 	"time"
+
+	"github.com/klauspost/compress/zstd"
 )
 
 // !!!NOTE!!!
@@ -441,6 +443,71 @@ func TestMaxAge(t *testing.T) {
 	existsWithContent(backupFile(dir), b2, t)
 }
 
+func TestMaxTotalSize(t *testing.T) {
+	currentTime = fakeTime
+	megabyte = 1
+
+	dir := makeTempDir("TestMaxTotalSize", t)
+	defer os.RemoveAll(dir)
+
+	filename := logFile(dir)
+
+	// a compressed backup left by an earlier run counts as well.
+	oldCompressed := filepath.Join(dir,
+		"foobar-"+fakeTime().Add(-24*time.Hour).UTC().Format(backupTimeFormat)+".log"+compressSuffix)
+	err := ioutil.WriteFile(oldCompressed, []byte("gzip!!"), 0644)
+	isNil(err, t)
+
+	l := &Logger{
+		Filename:     filename,
+		MaxSize:      10,
+		MaxTotalSize: 20,
+	}
+	defer l.Close()
+	b := []byte("boooooo!")
+	n, err := l.Write(b)
+	isNil(err, t)
+	equals(len(b), n, t)
+
+	<-time.After(10 * time.Millisecond)
+
+	// 8 bytes of log and 6 of backup fit in the budget.
+	fileCount(dir, 2, t)
+	exists(oldCompressed, t)
+
+	newFakeTime()
+	backup1 := backupFile(dir)
+
+	b2 := []byte("fooooooo!")
+	n, err = l.Write(b2)
+	isNil(err, t)
+	equals(len(b2), n, t)
+
+	<-time.After(10 * time.Millisecond)
+
+	// 9 + 8 bytes leave no room for the compressed backup.
+	fileCount(dir, 2, t)
+	notExist(oldCompressed, t)
+	existsWithContent(backup1, b, t)
+	existsWithContent(filename, b2, t)
+
+	newFakeTime()
+	backup2 := backupFile(dir)
+
+	b3 := []byte("baaaaaar!")
+	n, err = l.Write(b3)
+	isNil(err, t)
+	equals(len(b3), n, t)
+
+	<-time.After(10 * time.Millisecond)
+
+	// the oldest backup goes first.
+	fileCount(dir, 2, t)
+	notExist(backup1, t)
+	existsWithContent(backup2, b2, t)
+	existsWithContent(filename, b3, t)
+}
+
 func TestOldLogFiles(t *testing.T) {
 	currentTime = fakeTime
 	megabyte = 1
@@ -491,6 +558,9 @@ func TestTimeFromName(t *testing.T) {
 		wantErr  bool
 	}{
 		{"foo-2014-05-04T14-44-33.555.log", time.Date(2014, 5, 4, 14, 44, 33, 555000000, time.UTC), false},
+		{"foo-2014-05-04T14-44-33.555.log.gz", time.Date(2014, 5, 4, 14, 44, 33, 555000000, time.UTC), false},
+		{"foo-2014-05-04T14-44-33.555.log.zst", time.Date(2014, 5, 4, 14, 44, 33, 555000000, time.UTC), false},
+		{"foo-2014-05-04T14-44-33.555.log.bz2", time.Time{}, true},
 		{"foo-2014-05-04T14-44-33.555", time.Time{}, true},
 		{"2014-05-04T14-44-33.555.log", time.Time{}, true},
 		{"foo.log", time.Time{}, true},
@@ -530,6 +600,136 @@ func TestLocalTime(t *testing.T) {
 	existsWithContent(backupFileLocal(dir), b, t)
 }
 
+func TestRotationInterval(t *testing.T) {
+	currentTime = fakeTime
+	megabyte = 1
+	fakeCurrentTime = time.Date(2016, 11, 11, 18, 30, 0, 0, time.UTC)
+
+	dir := makeTempDir("TestRotationInterval", t)
+	defer os.RemoveAll(dir)
+
+	filename := logFile(dir)
+	l := &Logger{
+		Filename:         filename,
+		MaxSize:          100,
+		RotationInterval: 24 * time.Hour,
+	}
+	defer l.Close()
+	b := []byte("boo!")
+	n, err := l.Write(b)
+	isNil(err, t)
+	equals(len(b), n, t)
+
+	// still the same day
+	fakeCurrentTime = time.Date(2016, 11, 11, 23, 59, 59, 0, time.UTC)
+	b2 := []byte("foo!")
+	n, err = l.Write(b2)
+	isNil(err, t)
+	equals(len(b2), n, t)
+	fileCount(dir, 1, t)
+
+	fakeCurrentTime = time.Date(2016, 11, 12, 0, 0, 1, 0, time.UTC)
+	b3 := []byte("baaaar!")
+	n, err = l.Write(b3)
+	isNil(err, t)
+	equals(len(b3), n, t)
+
+	// the backup is named after the day it covers, not the rotation time.
+	existsWithContent(filename, b3, t)
+	existsWithContent(filepath.Join(dir, "foobar-2016-11-11T00-00-00.000.log"), append(b, b2...), t)
+	fileCount(dir, 2, t)
+}
+
+func TestRotationIntervalShared(t *testing.T) {
+	currentTime = fakeTime
+	megabyte = 1
+	fakeCurrentTime = time.Date(2016, 11, 11, 18, 30, 0, 0, time.UTC)
+
+	dir := makeTempDir("TestRotationIntervalShared", t)
+	defer os.RemoveAll(dir)
+
+	// two processes writing the same file
+	filename := logFile(dir)
+	first := &Logger{Filename: filename, MaxSize: 100, RotationInterval: 24 * time.Hour}
+	defer first.Close()
+	second := &Logger{Filename: filename, MaxSize: 100, RotationInterval: 24 * time.Hour}
+	defer second.Close()
+	b := []byte("boo!")
+	_, err := first.Write(b)
+	isNil(err, t)
+	b2 := []byte("foo!")
+	_, err = second.Write(b2)
+	isNil(err, t)
+
+	fakeCurrentTime = time.Date(2016, 11, 12, 0, 0, 1, 0, time.UTC)
+	b3 := []byte("baaaar!")
+	_, err = first.Write(b3)
+	isNil(err, t)
+	// the second one writes to the file the first one started
+	b4 := []byte("baz!")
+	_, err = second.Write(b4)
+	isNil(err, t)
+
+	existsWithContent(filename, append(b3, b4...), t)
+	existsWithContent(filepath.Join(dir, "foobar-2016-11-11T00-00-00.000.log"), append(b, b2...), t)
+	fileCount(dir, 2, t)
+}
+
+func TestRotationIntervalOnOpen(t *testing.T) {
+	currentTime = fakeTime
+	megabyte = 1
+	fakeCurrentTime = time.Date(2016, 11, 12, 9, 15, 0, 0, time.UTC)
+
+	dir := makeTempDir("TestRotationIntervalOnOpen", t)
+	defer os.RemoveAll(dir)
+
+	filename := logFile(dir)
+	start := []byte("boo!")
+	err := ioutil.WriteFile(filename, start, 0600)
+	isNil(err, t)
+	lastWrite := time.Date(2016, 11, 12, 7, 40, 0, 0, time.UTC)
+	isNil(os.Chtimes(filename, lastWrite, lastWrite), t)
+
+	l := &Logger{
+		Filename:         filename,
+		MaxSize:          100,
+		RotationInterval: time.Hour,
+	}
+	defer l.Close()
+	b := []byte("foo!")
+	n, err := l.Write(b)
+	isNil(err, t)
+	equals(len(b), n, t)
+
+	// the file left by the previous run is rotated as the log of 7 o'clock.
+	existsWithContent(filename, b, t)
+	existsWithContent(filepath.Join(dir, "foobar-2016-11-12T07-00-00.000.log"), start, t)
+	fileCount(dir, 2, t)
+}
+
+func TestIntervalBoundaries(t *testing.T) {
+	day := time.Date(2016, 11, 11, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		interval time.Duration
+		now      time.Time
+		start    time.Time
+		end      time.Time
+	}{
+		{time.Hour, day.Add(90 * time.Minute), day.Add(time.Hour), day.Add(2 * time.Hour)},
+		{6 * time.Hour, day.Add(23 * time.Hour), day.Add(18 * time.Hour), day.AddDate(0, 0, 1)},
+		{7 * time.Hour, day.Add(22 * time.Hour), day.Add(21 * time.Hour), day.AddDate(0, 0, 1)},
+		{24 * time.Hour, day.Add(23 * time.Hour), day, day.AddDate(0, 0, 1)},
+		{48 * time.Hour, day.Add(time.Minute), day, day.AddDate(0, 0, 2)},
+	}
+
+	for _, test := range tests {
+		l := &Logger{RotationInterval: test.interval}
+		start := l.intervalStart(test.now)
+		equals(test.start, start, t)
+		equals(test.end, l.intervalEnd(start), t)
+	}
+}
+
 func TestRotate(t *testing.T) {
 	currentTime = fakeTime
 	dir := makeTempDir("TestRotate", t)
@@ -636,6 +836,240 @@ func TestCompressOnRotate(t *testing.T) {
 	fileCount(dir, 2, t)
 }
 
+func TestCompressZstd(t *testing.T) {
+	currentTime = fakeTime
+	megabyte = 1
+
+	dir := makeTempDir("TestCompressZstd", t)
+	defer os.RemoveAll(dir)
+
+	filename := logFile(dir)
+
+	// a gzip backup of an earlier setting is kept next to the zstd ones.
+	oldBackup := filepath.Join(dir,
+		"foobar-"+fakeTime().Add(-24*time.Hour).UTC().Format(backupTimeFormat)+".log"+compressSuffix)
+	err := ioutil.WriteFile(oldBackup, []byte("gzip!"), 0644)
+	isNil(err, t)
+
+	l := &Logger{
+		Compression: "zstd:4",
+		Filename:    filename,
+		MaxSize:     10,
+		MaxBackups:  2,
+	}
+	defer l.Close()
+	b := []byte("boo!")
+	n, err := l.Write(b)
+	isNil(err, t)
+	equals(len(b), n, t)
+
+	newFakeTime()
+
+	err = l.Rotate()
+	isNil(err, t)
+
+	// we need to wait a little bit since the files get compressed on a different
+	// goroutine.
+	<-time.After(300 * time.Millisecond)
+
+	compressed, err := ioutil.ReadFile(backupFile(dir) + zstdSuffix)
+	isNil(err, t)
+	dec, err := zstd.NewReader(nil)
+	isNil(err, t)
+	defer dec.Close()
+	decompressed, err := dec.DecodeAll(compressed, nil)
+	isNil(err, t)
+	equals(b, decompressed, t)
+	notExist(backupFile(dir), t)
+
+	existsWithContent(oldBackup, []byte("gzip!"), t)
+	fileCount(dir, 3, t)
+
+	newFakeTime()
+
+	err = l.Rotate()
+	isNil(err, t)
+
+	<-time.After(300 * time.Millisecond)
+
+	// the gzip backup is the oldest of three and gets removed.
+	notExist(oldBackup, t)
+	exists(backupFile(dir)+zstdSuffix, t)
+	fileCount(dir, 3, t)
+}
+
+func TestCompressionSetting(t *testing.T) {
+	tests := []struct {
+		compress    bool
+		compression string
+		suffix      string
+	}{
+		{false, "", ""},
+		{true, "", compressSuffix},
+		{false, "gzip:9", compressSuffix},
+		{false, "GZIP", compressSuffix},
+		{false, "zstd", zstdSuffix},
+		{false, "zstd:1", zstdSuffix},
+		{true, "none", ""},
+		{false, "lzma", compressSuffix},
+	}
+
+	for _, test := range tests {
+		l := &Logger{Compress: test.compress, Compression: test.compression}
+		c := l.codec()
+		if test.suffix == "" {
+			assert(c == nil, t, "expected no compression for %q, got %v", test.compression, c)
+			continue
+		}
+		assert(c != nil, t, "expected compression for %q", test.compression)
+		equals(test.suffix, c.suffix, t)
+
+		// every level given must be accepted by the writer.
+		w, err := c.newWriter(ioutil.Discard)
+		isNil(err, t)
+		isNil(w.Close(), t)
+	}
+}
+
+func TestOnRotate(t *testing.T) {
+	currentTime = fakeTime
+	megabyte = 1
+
+	dir := makeTempDir("TestOnRotate", t)
+	defer os.RemoveAll(dir)
+
+	rotated := make(chan string, 2)
+	filename := logFile(dir)
+	l := &Logger{
+		Compress:   true,
+		Filename:   filename,
+		MaxSize:    10,
+		BackupLink: "foobar.log.last",
+		OnRotate:   func(backupPath string) { rotated <- backupPath },
+	}
+	defer l.Close()
+	b := []byte("boo!")
+	n, err := l.Write(b)
+	isNil(err, t)
+	equals(len(b), n, t)
+
+	newFakeTime()
+
+	// this rotates.
+	b2 := []byte("foooooo!")
+	n, err = l.Write(b2)
+	isNil(err, t)
+	equals(len(b2), n, t)
+
+	// the callback gets the backup once compressed.
+	select {
+	case path := <-rotated:
+		equals(backupFile(dir)+compressSuffix, path, t)
+	case <-time.After(time.Second):
+		t.Fatal("OnRotate was not called")
+	}
+	notExist(backupFile(dir), t)
+
+	link := filepath.Join(dir, "foobar.log.last")
+	target, err := os.Readlink(link)
+	isNil(err, t)
+	equals(filepath.Base(backupFile(dir))+compressSuffix, target, t)
+
+	newFakeTime()
+
+	err = l.Rotate()
+	isNil(err, t)
+
+	select {
+	case path := <-rotated:
+		equals(backupFile(dir)+compressSuffix, path, t)
+	case <-time.After(time.Second):
+		t.Fatal("OnRotate was not called")
+	}
+	target, err = os.Readlink(link)
+	isNil(err, t)
+	equals(filepath.Base(backupFile(dir))+compressSuffix, target, t)
+
+	// the log file, two backups and the link.
+	fileCount(dir, 4, t)
+}
+
+func TestSyncEvery(t *testing.T) {
+	currentTime = fakeTime
+	megabyte = 1
+
+	dir := makeTempDir("TestSyncEvery", t)
+	defer os.RemoveAll(dir)
+
+	l := &Logger{
+		Filename:  logFile(dir),
+		MaxSize:   100,
+		SyncEvery: 2,
+	}
+	defer l.Close()
+	b := []byte("boo!")
+	_, err := l.Write(b)
+	isNil(err, t)
+	equals(1, l.unsynced, t)
+
+	_, err = l.Write(b)
+	isNil(err, t)
+	equals(0, l.unsynced, t)
+
+	_, err = l.Write(b)
+	isNil(err, t)
+	isNil(l.Sync(), t)
+	equals(0, l.unsynced, t)
+	existsWithContent(logFile(dir), []byte("boo!boo!boo!"), t)
+}
+
+func TestSyncInterval(t *testing.T) {
+	currentTime = fakeTime
+	megabyte = 1
+
+	dir := makeTempDir("TestSyncInterval", t)
+	defer os.RemoveAll(dir)
+
+	l := &Logger{
+		Filename:     logFile(dir),
+		MaxSize:      100,
+		SyncInterval: 10 * time.Millisecond,
+	}
+	defer l.Close()
+	_, err := l.Write([]byte("boo!"))
+	isNil(err, t)
+
+	l.mu.Lock()
+	assert(l.syncTimer != nil, t, "expected a pending sync")
+	l.mu.Unlock()
+
+	<-time.After(100 * time.Millisecond)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	equals(0, l.unsynced, t)
+	assert(l.syncTimer == nil, t, "expected no pending sync")
+}
+
+func TestSyncNotOpened(t *testing.T) {
+	currentTime = fakeTime
+
+	dir := makeTempDir("TestSyncNotOpened", t)
+	defer os.RemoveAll(dir)
+
+	// nothing to sync yet.
+	l := &Logger{Filename: logFile(dir)}
+	isNil(l.Sync(), t)
+	fileCount(dir, 0, t)
+
+	// the file written by another process is synced, not created again.
+	err := ioutil.WriteFile(logFile(dir), []byte("boo!"), 0644)
+	isNil(err, t)
+	isNil(l.Sync(), t)
+	existsWithContent(logFile(dir), []byte("boo!"), t)
+	equals((*os.File)(nil), l.file, t)
+}
+
 func TestCompressOnResume(t *testing.T) {
 	currentTime = fakeTime
 	megabyte = 1
@@ -0,0 +1,278 @@
+// Package mountinfo parses the mount table of /proc/<pid>/mountinfo, as
+// described in proc_pid_mountinfo(5).
+package mountinfo
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Self is the mount table seen by the process.
+const Self = "/proc/self/mountinfo"
+
+// ErrMalformed reports a line which is not a mountinfo entry.
+var ErrMalformed = errors.New("malformed mountinfo line")
+
+// Mount is an entry of the mount table, its paths unescaped.
+type Mount struct {
+	ID       int
+	ParentID int
+	Major    uint32
+	Minor    uint32
+	//the directory of the file system mounted, "/" unless a bind mount or
+	//a btrfs subvolume
+	Root       string
+	MountPoint string
+	Options    []string
+	//the optional fields as they are, the known ones parsed below
+	Optional      []string
+	Shared        int
+	Master        int
+	PropagateFrom int
+	Unbindable    bool
+	FSType        string
+	Source        string
+	SuperOptions  []string
+}
+
+// DevNum returns the major:minor of the file system.
+func (m Mount) DevNum() string {
+	return fmt.Sprintf("%d:%d", m.Major, m.Minor)
+}
+
+// String formats the entry as a line of the mount table.
+func (m Mount) String() string {
+	fields := []string{
+		strconv.Itoa(m.ID),
+		strconv.Itoa(m.ParentID),
+		m.DevNum(),
+		escape(m.Root),
+		escape(m.MountPoint),
+		escapeOptions(m.Options),
+	}
+	for _, tag := range m.Optional {
+		if tag == "-" {
+			//not to be taken for the separator
+			tag = `\055`
+		} else {
+			tag = escape(tag)
+		}
+		fields = append(fields, tag)
+	}
+	fields = append(fields, "-", escape(m.FSType), escape(m.Source), escapeOptions(m.SuperOptions))
+	return strings.Join(fields, " ")
+}
+
+// Read returns the mount table of the process, see ReadFile.
+func Read() ([]Mount, error) {
+	return ReadFile(Self)
+}
+
+// ReadFile returns the mount table of path, a /proc/<pid>/mountinfo. The
+// entries are returned along with the error of the malformed lines, see
+// Parse.
+func ReadFile(path string) ([]Mount, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	mounts, err := Parse(data)
+	if err != nil {
+		return mounts, fmt.Errorf("%s: %w", path, err)
+	}
+	return mounts, nil
+}
+
+// Parse returns the entries of a mount table, skipping the empty lines. A
+// malformed line is skipped too, the others are still returned along with
+// an error wrapping ErrMalformed for each skipped line.
+func Parse(data []byte) ([]Mount, error) {
+	var mounts []Mount
+	var errs []error
+	for i, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		m, err := ParseLine(line)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("line %d: %w", i+1, err))
+			continue
+		}
+		mounts = append(mounts, m)
+	}
+	return mounts, errors.Join(errs...)
+}
+
+// ParseLine parses an entry of the mount table, such as
+//
+//	36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw,errors=continue
+//
+// where any number of optional fields, master:1 here, precede the "-".
+func ParseLine(line string) (Mount, error) {
+	var m Mount
+	//single spaces, an empty field such as the source of some tmpfs being
+	//two spaces in a row
+	fields := strings.Split(line, " ")
+	//the first six fields, then the separator, searched after them as an
+	//optional field may not be "-"
+	sep := -1
+	for i := 6; i < len(fields); i++ {
+		if fields[i] == "-" {
+			sep = i
+			break
+		}
+	}
+	if sep < 0 {
+		return m, fmt.Errorf("%w: no separator: %q", ErrMalformed, line)
+	}
+	if len(fields) != sep+4 {
+		return m, fmt.Errorf("%w: %d fields after the separator: %q", ErrMalformed, len(fields)-sep-1, line)
+	}
+
+	var err error
+	if m.ID, err = strconv.Atoi(fields[0]); err != nil {
+		return m, fmt.Errorf("%w: mount id: %v", ErrMalformed, err)
+	}
+	if m.ParentID, err = strconv.Atoi(fields[1]); err != nil {
+		return m, fmt.Errorf("%w: parent id: %v", ErrMalformed, err)
+	}
+	if m.Major, m.Minor, err = parseDevNum(fields[2]); err != nil {
+		return m, fmt.Errorf("%w: major:minor: %v", ErrMalformed, err)
+	}
+	m.Root = unescape(fields[3])
+	m.MountPoint = unescape(fields[4])
+	m.Options = parseOptions(fields[5])
+	for _, field := range fields[6:sep] {
+		tag := unescape(field)
+		if err := m.parseOptional(tag); err != nil {
+			return m, fmt.Errorf("%w: optional field %q: %v", ErrMalformed, tag, err)
+		}
+		m.Optional = append(m.Optional, tag)
+	}
+	m.FSType = unescape(fields[sep+1])
+	m.Source = unescape(fields[sep+2])
+	m.SuperOptions = parseOptions(fields[sep+3])
+	return m, nil
+}
+
+func parseDevNum(field string) (uint32, uint32, error) {
+	major, minor, ok := strings.Cut(field, ":")
+	if !ok {
+		return 0, 0, errors.New("no colon")
+	}
+	ma, err := strconv.ParseUint(major, 10, 32)
+	if err != nil {
+		return 0, 0, err
+	}
+	mi, err := strconv.ParseUint(minor, 10, 32)
+	if err != nil {
+		return 0, 0, err
+	}
+	return uint32(ma), uint32(mi), nil
+}
+
+// parseOptional records the propagation of a known optional field, the
+// others being kept in Optional only.
+func (m *Mount) parseOptional(tag string) error {
+	if tag == "unbindable" {
+		m.Unbindable = true
+		return nil
+	}
+	name, value, ok := strings.Cut(tag, ":")
+	if !ok {
+		return nil
+	}
+	var dest *int
+	switch name {
+	case "shared":
+		dest = &m.Shared
+	case "master":
+		dest = &m.Master
+	case "propagate_from":
+		dest = &m.PropagateFrom
+	default:
+		return nil
+	}
+	group, err := strconv.Atoi(value)
+	if err != nil {
+		return err
+	}
+	if group <= 0 {
+		return errors.New("not a peer group")
+	}
+	*dest = group
+	return nil
+}
+
+// parseOptions splits options on their commas, a comma in a value being
+// escaped by the kernel.
+func parseOptions(field string) []string {
+	options := strings.Split(field, ",")
+	for i, option := range options {
+		options[i] = unescape(option)
+	}
+	return options
+}
+
+func escapeOptions(options []string) string {
+	escaped := make([]string, len(options))
+	for i, option := range options {
+		escaped[i] = escapeComma(escape(option))
+	}
+	return strings.Join(escaped, ",")
+}
+
+// unescape decodes the octal escapes, \040 for a space, the kernel writes
+// for the white space and the backslash. A backslash not followed by three
+// octal digits is kept.
+func unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) && isOctalByte(s[i+1:i+4]) {
+			b.WriteByte((s[i+1]-'0')<<6 | (s[i+2]-'0')<<3 | (s[i+3] - '0'))
+			i += 3
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func isOctalByte(s string) bool {
+	return s[0] >= '0' && s[0] <= '3' &&
+		s[1] >= '0' && s[1] <= '7' &&
+		s[2] >= '0' && s[2] <= '7'
+}
+
+// escape is the reverse of unescape.
+func escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; isSpace(rune(c)) || c == '\\' {
+			fmt.Fprintf(&b, `\%03o`, c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// isSpace tells whether r is escaped, the kernel separating the fields
+// with spaces.
+func isSpace(r rune) bool {
+	switch r {
+	case ' ', '\t', '\n', '\v', '\f', '\r':
+		return true
+	}
+	return false
+}
+
+func escapeComma(s string) string {
+	return strings.ReplaceAll(s, ",", `\054`)
+}
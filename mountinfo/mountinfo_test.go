@@ -0,0 +1,194 @@
+package mountinfo
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    Mount
+		wantErr bool
+	}{
+		{
+			name: "one optional field",
+			line: "35 29 8:5 / /data rw,relatime shared:7 - ext4 /dev/sda5 rw",
+			want: Mount{
+				ID: 35, ParentID: 29, Major: 8, Minor: 5,
+				Root: "/", MountPoint: "/data",
+				Options:  []string{"rw", "relatime"},
+				Optional: []string{"shared:7"}, Shared: 7,
+				FSType: "ext4", Source: "/dev/sda5",
+				SuperOptions: []string{"rw"},
+			},
+		},
+		{
+			name: "no optional field",
+			line: "22 1 253:1 / /var/lib/docker rw,relatime - xfs /dev/mapper/vg-docker rw,attr2,inode64",
+			want: Mount{
+				ID: 22, ParentID: 1, Major: 253, Minor: 1,
+				Root: "/", MountPoint: "/var/lib/docker",
+				Options: []string{"rw", "relatime"},
+				FSType:  "xfs", Source: "/dev/mapper/vg-docker",
+				SuperOptions: []string{"rw", "attr2", "inode64"},
+			},
+		},
+		{
+			name: "several optional fields",
+			line: "807 790 7:1 / /var/lib/waydroid/rootfs/vendor ro,relatime shared:446 master:12 propagate_from:3 - ext4 /dev/loop1 ro",
+			want: Mount{
+				ID: 807, ParentID: 790, Major: 7, Minor: 1,
+				Root: "/", MountPoint: "/var/lib/waydroid/rootfs/vendor",
+				Options:  []string{"ro", "relatime"},
+				Optional: []string{"shared:446", "master:12", "propagate_from:3"},
+				Shared:   446, Master: 12, PropagateFrom: 3,
+				FSType: "ext4", Source: "/dev/loop1",
+				SuperOptions: []string{"ro"},
+			},
+		},
+		{
+			name: "unbindable and unknown tags",
+			line: "40 29 0:27 /@data /data rw unbindable future:tag - btrfs /dev/nvme0n1p2 rw,subvol=/@data",
+			want: Mount{
+				ID: 40, ParentID: 29, Major: 0, Minor: 27,
+				Root: "/@data", MountPoint: "/data",
+				Options:    []string{"rw"},
+				Optional:   []string{"unbindable", "future:tag"},
+				Unbindable: true,
+				FSType:     "btrfs", Source: "/dev/nvme0n1p2",
+				SuperOptions: []string{"rw", "subvol=/@data"},
+			},
+		},
+		{
+			name: "octal escapes",
+			line: `120 29 0:53 /a\134b /media/My\040Disk\011x rw shared:60 - fuse.sshfs me@host:/with\040space rw,subvol=/x\054y,user_id=0`,
+			want: Mount{
+				ID: 120, ParentID: 29, Major: 0, Minor: 53,
+				Root: `/a\b`, MountPoint: "/media/My Disk\tx",
+				Options:  []string{"rw"},
+				Optional: []string{"shared:60"}, Shared: 60,
+				FSType: "fuse.sshfs", Source: "me@host:/with space",
+				SuperOptions: []string{"rw", "subvol=/x,y", "user_id=0"},
+			},
+		},
+		{
+			name: "backslash without octal digits",
+			line: `50 29 0:45 / /mnt/a\b\04 rw - nfs server:/export\777 rw`,
+			want: Mount{
+				ID: 50, ParentID: 29, Major: 0, Minor: 45,
+				Root: "/", MountPoint: `/mnt/a\b\04`,
+				Options: []string{"rw"},
+				FSType:  "nfs", Source: `server:/export\777`,
+				SuperOptions: []string{"rw"},
+			},
+		},
+		{
+			name: "empty source",
+			line: "44 29 0:40 / /mnt/x rw,relatime shared:20 - tmpfs  rw,size=10k",
+			want: Mount{
+				ID: 44, ParentID: 29, Major: 0, Minor: 40,
+				Root: "/", MountPoint: "/mnt/x",
+				Options:  []string{"rw", "relatime"},
+				Optional: []string{"shared:20"}, Shared: 20,
+				FSType: "tmpfs", Source: "",
+				SuperOptions: []string{"rw", "size=10k"},
+			},
+		},
+		{
+			name: "mount point named like the separator",
+			line: "60 29 8:1 / /- rw - - none rw",
+			want: Mount{
+				ID: 60, ParentID: 29, Major: 8, Minor: 1,
+				Root: "/", MountPoint: "/-",
+				Options: []string{"rw"},
+				FSType:  "-", Source: "none",
+				SuperOptions: []string{"rw"},
+			},
+		},
+		{name: "no separator", line: "35 29 8:5 / /data rw,relatime shared:7 ext4 /dev/sda5 rw", wantErr: true},
+		{name: "too few fields", line: "35 29 8:5 / /data - ext4 /dev/sda5 rw", wantErr: true},
+		{name: "missing super options", line: "35 29 8:5 / /data rw - ext4 /dev/sda5", wantErr: true},
+		{name: "extra field", line: "35 29 8:5 / /data rw - ext4 /dev/sda5 rw extra", wantErr: true},
+		{name: "bad mount id", line: "x 29 8:5 / /data rw - ext4 /dev/sda5 rw", wantErr: true},
+		{name: "bad major:minor", line: "35 29 8.5 / /data rw - ext4 /dev/sda5 rw", wantErr: true},
+		{name: "bad peer group", line: "35 29 8:5 / /data rw shared:x - ext4 /dev/sda5 rw", wantErr: true},
+		{name: "empty", line: "", wantErr: true},
+		{name: "tab separated", line: "35\t29 8:5 / /data rw - ext4 /dev/sda5 rw", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLine(tt.line)
+			if tt.wantErr {
+				if !errors.Is(err, ErrMalformed) {
+					t.Errorf("ParseLine() error = %v, want ErrMalformed", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseLine() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseLine() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	data := "29 1 252:0 / / rw,relatime shared:1 - ext4 /dev/mapper/vg-root rw\n" +
+		"\n" +
+		"35 29 8:5 / /data rw,relatime shared:7 - ext4 /dev/sda5 rw\n"
+	mounts, err := Parse([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mounts) != 2 || mounts[0].MountPoint != "/" || mounts[1].DevNum() != "8:5" {
+		t.Errorf("Parse() = %+v", mounts)
+	}
+
+	//the malformed lines are skipped, not the whole table
+	mounts, err = Parse([]byte(data + "36 29 8:5 /home\n37 29 8:6 / /srv rw - ext4 /dev/sda6 rw\n"))
+	if !errors.Is(err, ErrMalformed) || err.Error()[:7] != "line 4:" {
+		t.Errorf("Parse() error = %v, want the line of the malformed entry", err)
+	}
+	if len(mounts) != 3 || mounts[2].MountPoint != "/srv" {
+		t.Errorf("Parse() = %+v, want the well formed entries", mounts)
+	}
+}
+
+func TestString(t *testing.T) {
+	line := `120 29 0:53 / /media/My\040Disk rw,relatime shared:60 - nfs4 nas:/export rw,subvol=/x\054y`
+	m, err := ParseLine(line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := m.String(); got != line {
+		t.Errorf("String() = %q, want %q", got, line)
+	}
+}
+
+func FuzzParseLine(f *testing.F) {
+	f.Add("35 29 8:5 / /data rw,relatime shared:7 - ext4 /dev/sda5 rw")
+	f.Add("22 1 253:1 / /var/lib/docker rw,relatime - xfs /dev/mapper/vg-docker rw,attr2,inode64")
+	f.Add("807 790 7:1 / /vendor ro shared:446 master:12 propagate_from:3 unbindable - ext4 /dev/loop1 ro")
+	f.Add(`120 29 0:53 /a\134b /media/My\040Disk rw - fuse.sshfs me@host:/x rw,subvol=/x\054y`)
+	f.Add("60 29 8:1 / /- rw \\055 - - none rw")
+	f.Add("44 29 0:40 / /mnt/x rw,relatime shared:20 - tmpfs  rw,size=10k")
+	f.Fuzz(func(t *testing.T, line string) {
+		m, err := ParseLine(line)
+		if err != nil {
+			return
+		}
+		//what String writes parses the same
+		again, err := ParseLine(m.String())
+		if err != nil {
+			t.Fatalf("ParseLine(%q) of String() error = %v", m.String(), err)
+		}
+		if !reflect.DeepEqual(again, m) {
+			t.Errorf("ParseLine(String()) = %+v, want %+v", again, m)
+		}
+	})
+}
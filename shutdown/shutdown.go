@@ -0,0 +1,141 @@
+// Package shutdown unmounts the file systems served by the process when it
+// is asked to stop, instead of leaving them to another fde_fs process.
+package shutdown
+
+import (
+	"errors"
+	"fde_fs/logger"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var shutdownLog = logger.Component("shutdown")
+
+// Timeout is how long a mount gets to detach and finish its in-flight
+// operations, once when unmounted and once more after a lazy unmount.
+var Timeout = 5 * time.Second
+
+// ErrInFlight reports a mount whose file system did not stop in time.
+var ErrInFlight = errors.New("operations still in flight")
+
+// Group tracks the mounts served by the process.
+type Group struct {
+	mu      sync.Mutex
+	mounts  []*Mount
+	closing bool
+}
+
+// Mount is a file system mounted on Target, serving requests until Done.
+type Mount struct {
+	Target  string
+	unmount func()
+	done    chan struct{}
+	once    sync.Once
+}
+
+// Add registers the mount of target, unmount asking its file system to
+// stop. It returns false once Shutdown is running, the caller must then not
+// mount target.
+func (g *Group) Add(target string, unmount func()) (*Mount, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.closing {
+		return nil, false
+	}
+	m := &Mount{Target: target, unmount: unmount, done: make(chan struct{})}
+	g.mounts = append(g.mounts, m)
+	return m, true
+}
+
+// Remove forgets m, once its file system returned or was detached, so
+// Shutdown does not unmount it again.
+func (g *Group) Remove(m *Mount) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	//a new slice, Shutdown may be going through the current one
+	mounts := make([]*Mount, 0, len(g.mounts))
+	for _, other := range g.mounts {
+		if other != m {
+			mounts = append(mounts, other)
+		}
+	}
+	g.mounts = mounts
+}
+
+// Done is called when the file system of m returned, its in-flight
+// operations being over.
+func (m *Mount) Done() {
+	m.once.Do(func() {
+		close(m.done)
+	})
+}
+
+func (m *Mount) wait(timeout time.Duration) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-m.done:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// Detach unmounts m and waits for its file system to drain. A mount still
+// busy after Timeout is lazily unmounted, then waited for again.
+func (m *Mount) Detach() error {
+	select {
+	case <-m.done:
+		return nil
+	default:
+	}
+	log := shutdownLog.With("path", m.Target)
+	//unmount may block, e.g. on fusermount, the timeout applies anyway
+	go m.unmount()
+	if m.wait(Timeout) {
+		log.Info("unmount_done")
+		return nil
+	}
+	log.Warn("unmount_timeout", "timeout", Timeout)
+	//EINVAL: not a mount point anymore
+	if err := syscall.Unmount(m.Target, syscall.MNT_DETACH); err != nil && !errors.Is(err, syscall.EINVAL) {
+		return logger.Wrap("unmount_detach", m.Target, err)
+	}
+	if !m.wait(Timeout) {
+		return logger.Wrap("drain", m.Target, ErrInFlight)
+	}
+	log.Info("unmount_detached")
+	return nil
+}
+
+// Shutdown unmounts every mount concurrently, refusing new ones, and returns
+// the targets which could not be detached or drained.
+func (g *Group) Shutdown() []string {
+	g.mu.Lock()
+	g.closing = true
+	mounts := g.mounts
+	g.mu.Unlock()
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed []string
+	)
+	for _, m := range mounts {
+		wg.Add(1)
+		go func(m *Mount) {
+			defer wg.Done()
+			if err := m.Detach(); err != nil {
+				shutdownLog.WithError(err).Error("unmount_failed", "path", m.Target)
+				mu.Lock()
+				failed = append(failed, m.Target)
+				mu.Unlock()
+			}
+		}(m)
+	}
+	wg.Wait()
+	sort.Strings(failed)
+	return failed
+}
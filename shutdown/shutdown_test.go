@@ -0,0 +1,54 @@
+package shutdown
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestShutdown(t *testing.T) {
+	defer func(timeout time.Duration) { Timeout = timeout }(Timeout)
+	Timeout = 50 * time.Millisecond
+
+	var g Group
+	//stops when unmounted
+	stopping, _ := g.Add("/stopping", nil)
+	stopping.unmount = stopping.Done
+	//already returned
+	stopped, _ := g.Add("/stopped", func() { t.Error("unmount of a stopped mount") })
+	stopped.Done()
+	//keeps serving, the lazy unmount of a directory which is not a mount
+	//point does not help
+	g.Add(t.TempDir(), func() {})
+	hung := g.mounts[2].Target
+
+	failed := g.Shutdown()
+	if want := []string{hung}; !reflect.DeepEqual(failed, want) {
+		t.Errorf("Shutdown() = %v, want %v", failed, want)
+	}
+	if _, ok := g.Add("/late", func() {}); ok {
+		t.Error("Add() accepted a mount during shutdown")
+	}
+}
+
+func TestRemove(t *testing.T) {
+	var g Group
+	first, _ := g.Add("/a", func() { t.Error("unmount of a removed mount") })
+	second, _ := g.Add("/a", func() {})
+	second.unmount = second.Done
+	g.Remove(first)
+	g.Remove(first)
+	if len(g.mounts) != 1 || g.mounts[0] != second {
+		t.Errorf("mounts after Remove() = %v, want the second one", g.mounts)
+	}
+	if failed := g.Shutdown(); len(failed) != 0 {
+		t.Errorf("Shutdown() = %v, want none", failed)
+	}
+}
+
+func TestShutdownEmpty(t *testing.T) {
+	var g Group
+	if failed := g.Shutdown(); len(failed) != 0 {
+		t.Errorf("Shutdown() = %v, want none", failed)
+	}
+}